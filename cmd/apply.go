@@ -1,33 +1,330 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"sync"
+	"text/tabwriter"
 
+	gospeckle "github.com/speckleworks/gospeckle/pkg"
 	"github.com/spf13/cobra"
 )
 
-var filename string
+var filenames []string
+var recursive bool
+var output string
+var atomic bool
 
 func init() {
 	rootCmd.AddCommand(applyCmd)
 
-	applyCmd.Flags().StringVarP(&filename, "filename", "f", "", "path to the file to read speckle resources from")
+	applyCmd.Flags().StringArrayVarP(&filenames, "filename", "f", nil, "file, directory or glob to read speckle resources from (\"-\" reads stdin, can be repeated)")
+	applyCmd.Flags().BoolVarP(&recursive, "recursive", "R", false, "process the directories passed to --filename recursively")
+	applyCmd.Flags().StringVarP(&output, "output", "o", "table", "output format of the apply report (table|json)")
+	applyCmd.Flags().BoolVar(&atomic, "atomic", false, "apply resources one by one and roll back every change if one of them fails")
+	applyCmd.MarkFlagRequired("filename")
 }
 
 // applyCmd represents the apply command
 var applyCmd = &cobra.Command{
 	Use:   "apply",
 	Short: "apply the contents of a file to a speckle server",
-	Long:  ``,
+	Long: `apply the contents of a file to a speckle server.
+
+Resources with an id are updated, all others are created. A report with one line
+per resource is printed once every request has finished and the command exits with
+a non-zero status if any resource failed to apply.
+
+With --atomic resources are applied in order and, if one fails, everything created
+or updated before it is deleted or restored to its previous state in reverse order.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		requestObjects, err := parseResourceFile(filename)
+		requestObjects, err := parseResourceFiles(filenames, recursive)
+
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
 
+		var results []ApplyResult
+		if atomic {
+			results = requestObjects.MakeRequestsAtomic(ctx, speckleClient)
+		} else {
+			results = requestObjects.MakeRequests(ctx, speckleClient)
+		}
+
+		err = printApplyResults(results, output)
 		if err != nil {
 			fmt.Println(err)
 			os.Exit(1)
 		}
 
-		requestObjects.MakeRequests(ctx, &speckleClient)
+		for _, res := range results {
+			if res.Failed() {
+				os.Exit(1)
+			}
+		}
 	},
 }
+
+// ApplyResult is the outcome of applying a single resource to a speckle server.
+type ApplyResult struct {
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Action string `json:"action"`
+	ID     string `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Failed reports whether the resource could not be applied.
+func (a ApplyResult) Failed() bool {
+	return a.Error != ""
+}
+
+// undoStep reverts a change made while applying a resource.
+type undoStep struct {
+	result ApplyResult
+	action string
+	undo   func() error
+}
+
+// applyStep applies a single resource. If saveState is set, apply also returns the
+// step that reverts the change, fetching the resource's prior state first for updates.
+type applyStep struct {
+	resource ApplyResult
+	apply    func(saveState bool) (ApplyResult, *undoStep)
+}
+
+func (r RequestObjects) applySteps(ctx context.Context, c *gospeckle.Client) []applyStep {
+	var steps []applyStep
+
+	for _, item := range r.Projects {
+		item := item
+		steps = append(steps, applyStep{
+			resource: ApplyResult{Kind: "project", Name: item.Name, ID: item.ID},
+			apply: func(saveState bool) (ApplyResult, *undoStep) {
+				return applyProject(ctx, c, item, saveState)
+			},
+		})
+	}
+
+	for _, item := range r.Streams {
+		item := item
+		steps = append(steps, applyStep{
+			resource: ApplyResult{Kind: "stream", Name: item.Name, ID: item.ID},
+			apply: func(saveState bool) (ApplyResult, *undoStep) {
+				return applyStream(ctx, c, item, saveState)
+			},
+		})
+	}
+
+	for _, item := range r.Clients {
+		item := item
+		steps = append(steps, applyStep{
+			resource: ApplyResult{Kind: "client", Name: item.DocumentName, ID: item.ID},
+			apply: func(saveState bool) (ApplyResult, *undoStep) {
+				return applyClient(ctx, c, item, saveState)
+			},
+		})
+	}
+
+	return steps
+}
+
+// MakeRequests applies every resource concurrently and returns one result per resource,
+// in the order projects, streams and clients were read.
+func (r RequestObjects) MakeRequests(ctx context.Context, c *gospeckle.Client) []ApplyResult {
+	steps := r.applySteps(ctx, c)
+	results := make([]ApplyResult, len(steps))
+	var wg sync.WaitGroup
+
+	for i, step := range steps {
+		wg.Add(1)
+		go func(res *ApplyResult, step applyStep) {
+			defer wg.Done()
+			*res, _ = step.apply(false)
+		}(&results[i], step)
+	}
+
+	wg.Wait()
+
+	return results
+}
+
+// MakeRequestsAtomic applies resources one at a time. As soon as one fails, every
+// resource applied before it is reverted in reverse order and the rollback is
+// appended to the results. Resources that were never attempted are reported as skipped.
+func (r RequestObjects) MakeRequestsAtomic(ctx context.Context, c *gospeckle.Client) []ApplyResult {
+	steps := r.applySteps(ctx, c)
+	var results []ApplyResult
+	var applied []*undoStep
+
+	for i, step := range steps {
+		res, undo := step.apply(true)
+		results = append(results, res)
+
+		if !res.Failed() {
+			applied = append(applied, undo)
+			continue
+		}
+
+		for _, skipped := range steps[i+1:] {
+			res := skipped.resource
+			res.Action = "skipped"
+			results = append(results, res)
+		}
+
+		for j := len(applied) - 1; j >= 0; j-- {
+			rollback := applied[j].result
+			rollback.Action = applied[j].action
+
+			if err := applied[j].undo(); err != nil {
+				rollback.Action = "rollback failed"
+				rollback.Error = err.Error()
+			}
+
+			results = append(results, rollback)
+		}
+
+		break
+	}
+
+	return results
+}
+
+func applyProject(ctx context.Context, c *gospeckle.Client, item ProjectInput, saveState bool) (ApplyResult, *undoStep) {
+	res := ApplyResult{Kind: "project", Name: item.Name, ID: item.ID}
+
+	if item.ID == "" {
+		p, _, err := c.Project.Create(ctx, item.ProjectRequest)
+		if err != nil {
+			return failed(res, err), nil
+		}
+
+		res.Action = "created"
+		res.ID = p.ID
+		return res, &undoStep{result: res, action: "rolled back (deleted)", undo: func() error {
+			_, err := c.Project.Delete(ctx, p.ID)
+			return err
+		}}
+	}
+
+	var prior gospeckle.Project
+	if saveState {
+		var err error
+		prior, _, err = c.Project.Get(ctx, item.ID)
+		if err != nil {
+			return failed(res, err), nil
+		}
+	}
+
+	_, err := c.Project.Update(ctx, item.ID, item.ProjectRequest)
+	if err != nil {
+		return failed(res, err), nil
+	}
+
+	res.Action = "updated"
+	return res, &undoStep{result: res, action: "rolled back (restored)", undo: func() error {
+		_, err := c.Project.Restore(ctx, item.ID, prior)
+		return err
+	}}
+}
+
+func applyStream(ctx context.Context, c *gospeckle.Client, item StreamInput, saveState bool) (ApplyResult, *undoStep) {
+	res := ApplyResult{Kind: "stream", Name: item.Name, ID: item.ID}
+
+	if item.ID == "" {
+		s, _, err := c.Stream.Create(ctx, item.StreamRequest)
+		if err != nil {
+			return failed(res, err), nil
+		}
+
+		res.Action = "created"
+		res.ID = s.StreamID
+		return res, &undoStep{result: res, action: "rolled back (deleted)", undo: func() error {
+			_, err := c.Stream.Delete(ctx, s.StreamID)
+			return err
+		}}
+	}
+
+	var prior gospeckle.Stream
+	if saveState {
+		var err error
+		prior, _, err = c.Stream.Get(ctx, item.ID)
+		if err != nil {
+			return failed(res, err), nil
+		}
+	}
+
+	_, err := c.Stream.Update(ctx, item.ID, item.StreamRequest)
+	if err != nil {
+		return failed(res, err), nil
+	}
+
+	res.Action = "updated"
+	return res, &undoStep{result: res, action: "rolled back (restored)", undo: func() error {
+		_, err := c.Stream.Restore(ctx, item.ID, prior)
+		return err
+	}}
+}
+
+func applyClient(ctx context.Context, c *gospeckle.Client, item ClientInput, saveState bool) (ApplyResult, *undoStep) {
+	res := ApplyResult{Kind: "client", Name: item.DocumentName, ID: item.ID}
+
+	if item.ID == "" {
+		p, _, err := c.APIClient.Create(ctx, item.APIClientRequest)
+		if err != nil {
+			return failed(res, err), nil
+		}
+
+		res.Action = "created"
+		res.ID = p.ID
+		return res, &undoStep{result: res, action: "rolled back (deleted)", undo: func() error {
+			_, err := c.APIClient.Delete(ctx, p.ID)
+			return err
+		}}
+	}
+
+	var prior gospeckle.APIClient
+	if saveState {
+		var err error
+		prior, _, err = c.APIClient.Get(ctx, item.ID)
+		if err != nil {
+			return failed(res, err), nil
+		}
+	}
+
+	_, err := c.APIClient.Update(ctx, item.ID, item.APIClientRequest)
+	if err != nil {
+		return failed(res, err), nil
+	}
+
+	res.Action = "updated"
+	return res, &undoStep{result: res, action: "rolled back (restored)", undo: func() error {
+		_, err := c.APIClient.Restore(ctx, item.ID, prior)
+		return err
+	}}
+}
+
+func failed(res ApplyResult, err error) ApplyResult {
+	res.Action = "failed"
+	res.Error = err.Error()
+	return res
+}
+
+// printApplyResults prints the results of an apply either as a table or as JSON.
+func printApplyResults(results []ApplyResult, format string) error {
+	switch format {
+	case "json":
+		return printJSON(results)
+	case "", "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "KIND\tNAME\tACTION\tID\tERROR")
+		for _, res := range results {
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", res.Kind, res.Name, res.Action, res.ID, res.Error)
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown output format: %v", format)
+	}
+}
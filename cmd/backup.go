@@ -0,0 +1,511 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	gospeckle "github.com/speckleworks/gospeckle/pkg"
+	"github.com/spf13/cobra"
+)
+
+// backupVersion is the version of the backup layout written by the backup command.
+const backupVersion = 1
+
+const backupManifestName = "manifest.json"
+
+// backupBulkSize is the number of objects requested at once.
+const backupBulkSize = 500
+
+// Kinds of resources in a backup, which are also the directories they are kept in.
+const (
+	backupProjects = "projects"
+	backupStreams  = "streams"
+	backupClients  = "clients"
+	backupObjects  = "objects"
+	backupComments = "comments"
+)
+
+var backupDir string
+var backupBase string
+
+func init() {
+	backupCmd.Flags().StringVarP(&backupDir, "output", "o", "", "the directory to write the backup to, which must not exist or be empty")
+	backupCmd.Flags().StringVar(&backupBase, "base", "", "an earlier backup to take unchanged resources from")
+	backupCmd.MarkFlagRequired("output")
+
+	rootCmd.AddCommand(backupCmd)
+}
+
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Back up the projects, streams, objects, clients and comments of the current account",
+	Long: `Backs up every project, stream and client of the current context's account, with
+the objects of the streams and the comments on all of them, to a directory:
+
+  manifest.json       the server, the date and every file with its sha256
+  projects/<id>.json
+  streams/<id>.json   with its layers and the IDs of its objects
+  clients/<id>.json
+  objects/<id>.json
+  comments/<id>.json
+
+With --base, resources whose updatedAt and __v haven't changed since an earlier
+backup are copied from it instead of being downloaded again. Comments are always
+listed again.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		w, err := newBackupWriter(backupDir, speckleClient.APIURL.String())
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		if backupBase != "" {
+			w.base, err = readBackup(backupBase)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			w.manifest.Base = backupBase
+		}
+
+		err = w.backup()
+		if err == nil {
+			err = w.writeManifest()
+		}
+		if err != nil {
+			fmt.Println(err)
+			fmt.Println("The backup is incomplete, it has no manifest.")
+			os.Exit(1)
+		}
+
+		counts := map[string]int{}
+		for _, e := range w.manifest.Entries {
+			counts[e.Kind]++
+		}
+		fmt.Printf("Backed up %v projects, %v streams, %v objects, %v clients and %v comments to %v",
+			counts[backupProjects], counts[backupStreams], counts[backupObjects], counts[backupClients], counts[backupComments], backupDir)
+		if w.base != nil {
+			fmt.Printf(", %v files unchanged since %v", w.reused, backupBase)
+		}
+		fmt.Println()
+	},
+}
+
+// backupManifest lists the files of a backup.
+type backupManifest struct {
+	Version   int       `json:"version"`
+	Server    string    `json:"server"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Base is the backup unchanged resources were copied from.
+	Base    string        `json:"base,omitempty"`
+	Entries []backupEntry `json:"entries"`
+}
+
+// backupEntry is a file of a backup, holding one resource.
+type backupEntry struct {
+	Kind      string     `json:"kind"`
+	ID        string     `json:"id"`
+	Path      string     `json:"path"`
+	SHA256    string     `json:"sha256"`
+	Size      int64      `json:"size"`
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+	Version   int        `json:"__v"`
+	// Resource is the kind and ID of the resource a comment is on.
+	Resource string `json:"resource,omitempty"`
+}
+
+func (e backupEntry) key() string {
+	return e.Kind + "/" + e.ID
+}
+
+// backup is a backup read from disk.
+type backup struct {
+	dir      string
+	manifest backupManifest
+	entries  map[string]backupEntry
+	// comments are the comment entries by the resource they are on.
+	comments map[string][]backupEntry
+}
+
+// readBackup reads the manifest of a backup.
+func readBackup(dir string) (*backup, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, backupManifestName))
+	if err != nil {
+		return nil, err
+	}
+
+	b := &backup{
+		dir:      dir,
+		entries:  map[string]backupEntry{},
+		comments: map[string][]backupEntry{},
+	}
+
+	err = json.Unmarshal(data, &b.manifest)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", filepath.Join(dir, backupManifestName), err)
+	}
+	if b.manifest.Version > backupVersion {
+		return nil, fmt.Errorf("%v has version %v, this version of gospeckle reads up to %v", dir, b.manifest.Version, backupVersion)
+	}
+
+	for _, e := range b.manifest.Entries {
+		b.entries[e.key()] = e
+		if e.Kind == backupComments {
+			b.comments[e.Resource] = append(b.comments[e.Resource], e)
+		}
+	}
+
+	return b, nil
+}
+
+// read returns the content of a file of the backup, verified against its checksum.
+func (b *backup) read(e backupEntry) ([]byte, error) {
+	data, err := ioutil.ReadFile(filepath.Join(b.dir, e.Path))
+	if err != nil {
+		return nil, err
+	}
+	if sum := sha256Hex(data); sum != e.SHA256 {
+		return nil, fmt.Errorf("%v: checksum mismatch, the file is corrupt", filepath.Join(b.dir, e.Path))
+	}
+	return data, nil
+}
+
+// unchanged reports whether the backup holds a resource as of updatedAt and version.
+func (b *backup) unchanged(kind string, id string, updatedAt *time.Time, version int) bool {
+	if b == nil || updatedAt == nil {
+		return false
+	}
+
+	e, ok := b.entries[kind+"/"+id]
+	if !ok || e.UpdatedAt == nil {
+		return false
+	}
+	return e.UpdatedAt.Equal(*updatedAt) && e.Version == version
+}
+
+// backupWriter writes a backup.
+type backupWriter struct {
+	dir      string
+	manifest backupManifest
+	written  map[string]bool
+	base     *backup
+	// reused is the number of files copied from the base backup.
+	reused int
+}
+
+func newBackupWriter(dir string, server string) (*backupWriter, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(infos) > 0 {
+		return nil, fmt.Errorf("%v isn't empty", dir)
+	}
+
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	return &backupWriter{
+		dir: dir,
+		manifest: backupManifest{
+			Version:   backupVersion,
+			Server:    server,
+			CreatedAt: time.Now().UTC(),
+		},
+		written: map[string]bool{},
+	}, nil
+}
+
+func (w *backupWriter) backup() error {
+	projects, _, err := speckleClient.Project.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, p := range projects {
+		if !w.reuseUnchanged(backupProjects, p.ID, p.Metadata) {
+			err = w.writeResource(backupProjects, p.ID, p.Metadata, p)
+			if err != nil {
+				return err
+			}
+		}
+
+		comments, _, err := speckleClient.ListArchivedComments(ctx, backupProjects, p.ID)
+		if err != nil {
+			return err
+		}
+		err = w.writeComments(comments)
+		if err != nil {
+			return err
+		}
+	}
+
+	streams, _, err := speckleClient.Stream.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, s := range streams {
+		err = w.backupStream(s.StreamID)
+		if err != nil {
+			return err
+		}
+	}
+
+	clients, _, err := speckleClient.APIClient.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, c := range clients {
+		if !w.reuseUnchanged(backupClients, c.ID, c.Metadata) {
+			err = w.writeResource(backupClients, c.ID, c.Metadata, c)
+			if err != nil {
+				return err
+			}
+		}
+
+		comments, _, err := speckleClient.ListArchivedComments(ctx, backupClients, c.ID)
+		if err != nil {
+			return err
+		}
+		err = w.writeComments(comments)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// backupStream writes a stream, its objects and the comments on them. Updating an
+// object doesn't change the streams it is in, so each object is checked against the
+// base backup on its own.
+func (w *backupWriter) backupStream(streamID string) error {
+	stream, _, err := speckleClient.Stream.Get(ctx, streamID)
+	if err != nil {
+		return err
+	}
+
+	if !w.reuseUnchanged(backupStreams, streamID, stream.Metadata) {
+		err = w.writeResource(backupStreams, streamID, stream.Metadata, stream)
+		if err != nil {
+			return err
+		}
+	}
+
+	comments, _, err := speckleClient.ListArchivedComments(ctx, backupStreams, streamID)
+	if err != nil {
+		return err
+	}
+	err = w.writeComments(comments)
+	if err != nil {
+		return err
+	}
+
+	// Objects shared with a stream backed up earlier were written with it.
+	var ids gospeckle.ObjectGetBulkIDs
+	for _, o := range stream.Objects {
+		if !w.written[backupObjects+"/"+o.ID] {
+			ids = append(ids, o.ID)
+		}
+	}
+
+	for i := 0; i < len(ids); i += backupBulkSize {
+		end := i + backupBulkSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		err = w.backupObjects(streamID, ids[i:end])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// backupObjects writes objects and the comments on them. Only their updatedAt, __v
+// and comments are fetched at first, and the objects that changed since the base
+// backup are then fetched in full.
+func (w *backupWriter) backupObjects(streamID string, ids gospeckle.ObjectGetBulkIDs) error {
+	commented := map[string]bool{}
+
+	changed := ids
+	if w.base != nil {
+		versions, _, err := speckleClient.Object.GetBulk(ctx, ids, gospeckle.ObjectGetBulkQuery{"fields": "updatedAt,__v,comments"})
+		if err != nil {
+			return err
+		}
+
+		changed = nil
+		for _, o := range versions {
+			commented[o.ID] = len(o.Comments) > 0
+			if !w.reuseUnchanged(backupObjects, o.ID, o.Metadata) {
+				changed = append(changed, o.ID)
+			}
+		}
+	}
+
+	if len(changed) > 0 {
+		objects, _, err := speckleClient.Object.GetBulkRaw(ctx, changed, nil)
+		if err != nil {
+			return err
+		}
+
+		for _, data := range objects {
+			var o gospeckle.Object
+			err = json.Unmarshal(data, &o)
+			if err != nil {
+				return err
+			}
+			commented[o.ID] = len(o.Comments) > 0
+
+			err = w.writeFile(backupEntry{Kind: backupObjects, ID: o.ID, UpdatedAt: o.UpdatedAt, Version: o.Version}, data)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, id := range ids {
+		if !w.written[backupObjects+"/"+id] {
+			return fmt.Errorf("object %v of stream %v could not be fetched", id, streamID)
+		}
+		if !commented[id] {
+			continue
+		}
+
+		comments, _, err := speckleClient.ListArchivedComments(ctx, backupObjects, id)
+		if err != nil {
+			return err
+		}
+		err = w.writeComments(comments)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *backupWriter) writeResource(kind string, id string, metadata gospeckle.Metadata, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return w.writeFile(backupEntry{Kind: kind, ID: id, UpdatedAt: metadata.UpdatedAt, Version: metadata.Version}, data)
+}
+
+func (w *backupWriter) writeComments(comments []gospeckle.ArchivedComment) error {
+	for _, c := range comments {
+		data, err := json.MarshalIndent(c, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		err = w.writeFile(backupEntry{
+			Kind:      backupComments,
+			ID:        c.ID,
+			UpdatedAt: c.UpdatedAt,
+			Version:   c.Version,
+			Resource:  backupResourceKind(c.Resource.ResourceType) + "/" + c.Resource.ResourceID,
+		}, data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFile writes the file of an entry, unless a resource shared by several others,
+// such as an object in several streams, was already written.
+func (w *backupWriter) writeFile(e backupEntry, data []byte) error {
+	if w.written[e.key()] {
+		return nil
+	}
+
+	e.Path = filepath.ToSlash(filepath.Join(e.Kind, e.ID+".json"))
+	e.SHA256 = sha256Hex(data)
+	e.Size = int64(len(data))
+
+	path := filepath.Join(w.dir, e.Path)
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(path, data, 0600)
+	if err != nil {
+		return err
+	}
+
+	w.written[e.key()] = true
+	w.manifest.Entries = append(w.manifest.Entries, e)
+	return nil
+}
+
+// reuse copies the file of a resource from the base backup, if it holds a valid one.
+func (w *backupWriter) reuse(kind string, id string) bool {
+	e, ok := w.base.entries[kind+"/"+id]
+	if !ok {
+		return false
+	}
+	if w.written[e.key()] {
+		return true
+	}
+
+	data, err := w.base.read(e)
+	if err != nil {
+		return false
+	}
+
+	err = w.writeFile(e, data)
+	if err != nil {
+		return false
+	}
+	w.reused++
+	return true
+}
+
+// reuseUnchanged copies a resource from the base backup if its updatedAt and __v
+// haven't changed since.
+func (w *backupWriter) reuseUnchanged(kind string, id string, metadata gospeckle.Metadata) bool {
+	return w.base.unchanged(kind, id, metadata.UpdatedAt, metadata.Version) && w.reuse(kind, id)
+}
+
+// writeManifest writes the manifest, last, so that a backup without one is known to
+// be incomplete.
+func (w *backupWriter) writeManifest() error {
+	data, err := json.MarshalIndent(w.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(w.dir, backupManifestName), data, 0600)
+}
+
+// backupResourceKind returns the backup kind of a comment's resource type, which the
+// server gives in the singular or the plural.
+func backupResourceKind(resourceType string) string {
+	switch resourceType {
+	case "project", backupProjects:
+		return backupProjects
+	case "stream", backupStreams:
+		return backupStreams
+	case "client", backupClients:
+		return backupClients
+	case "object", backupObjects:
+		return backupObjects
+	}
+	return resourceType
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	gospeckle "github.com/speckleworks/gospeckle/pkg"
+	"github.com/spf13/cobra"
+)
+
+// cacheDirEnv overrides the directory GET responses are cached in.
+const cacheDirEnv = "GOSPECKLE_CACHE_DIR"
+
+var useCache bool
+var cacheTTL time.Duration
+var offline bool
+
+func init() {
+	rootCmd.PersistentFlags().BoolVar(&useCache, "cache", false, "cache GET responses on disk and serve them while they are fresh")
+	rootCmd.PersistentFlags().DurationVar(&cacheTTL, "cache-ttl", 5*time.Minute, "how long cached responses are served without asking the server")
+	rootCmd.PersistentFlags().BoolVar(&offline, "offline", false, "serve GET requests from the cache only, without contacting the server")
+
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheLsCmd)
+	cacheCmd.AddCommand(cacheClearCmd)
+	cacheCmd.AddCommand(cacheSizeCmd)
+}
+
+// cacheDir returns the directory GET responses are cached in.
+func cacheDir() (string, error) {
+	if dir := os.Getenv(cacheDirEnv); dir != "" {
+		return dir, nil
+	}
+
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gospeckle"), nil
+}
+
+// newCache returns the cache used by the client when --cache or --offline is set, or
+// nil otherwise.
+func newCache() (*gospeckle.Cache, error) {
+	if !useCache && !offline {
+		return nil, nil
+	}
+
+	dir, err := cacheDir()
+	if err != nil {
+		return nil, err
+	}
+
+	cache := gospeckle.NewCache(dir, cacheTTL)
+	cache.Offline = offline
+	return cache, nil
+}
+
+// mustOpenCache returns the cache directory for the cache commands.
+func mustOpenCache() *gospeckle.Cache {
+	dir, err := cacheDir()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	return gospeckle.NewCache(dir, cacheTTL)
+}
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the on-disk cache of GET responses used with --cache and --offline",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var cacheLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List the cached responses",
+	Run: func(cmd *cobra.Command, args []string) {
+		entries, err := mustOpenCache().Entries()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].StoredAt.After(entries[j].StoredAt)
+		})
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "URL\tAGE\tSIZE\tVALIDATOR")
+		for _, e := range entries {
+			validator := e.ETag
+			if validator == "" {
+				validator = e.LastModified
+			}
+			age := time.Since(e.StoredAt).Round(time.Second)
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", e.URL, age, formatBytes(int64(len(e.Body))), validator)
+		}
+		w.Flush()
+	},
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove every cached response",
+	Run: func(cmd *cobra.Command, args []string) {
+		cache := mustOpenCache()
+
+		err := cache.Clear()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Printf("Cleared %v\n", cache.Dir)
+	},
+}
+
+var cacheSizeCmd = &cobra.Command{
+	Use:   "size",
+	Short: "Display the disk space used by the cache",
+	Run: func(cmd *cobra.Command, args []string) {
+		cache := mustOpenCache()
+
+		size, err := cache.Size()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		entries, err := cache.Entries()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("%v in %v responses (%v)\n", formatBytes(size), len(entries), cache.Dir)
+	},
+}
+
+// formatBytes formats a size in bytes with a binary unit.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
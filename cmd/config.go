@@ -9,12 +9,17 @@ import (
 )
 
 var (
-	user          string
-	email         string
-	token         string
-	server        string
-	host          string
-	serverVersion string
+	user            string
+	email           string
+	token           string
+	server          string
+	host            string
+	serverVersion   string
+	credentialStore string
+	resolved        bool
+	viewMerged      bool
+	newContextName  string
+	force           bool
 )
 
 func init() {
@@ -40,8 +45,32 @@ func init() {
 	useConfigContextCmd.Flags().StringVarP(&contextName, "name", "n", "", "the name of the context to be used")
 	useConfigContextCmd.MarkFlagRequired("name")
 
+	migrateCredentialsCmd.Flags().StringVar(&credentialStore, "store", "", "the credential store to move tokens to: file or helper:<command> (default is the config's credential-store)")
+
+	currentContextCmd.Flags().BoolVar(&resolved, "resolved", false, "show the context after environment variable and flag overrides, and where each value comes from")
+
+	deleteConfigUserCmd.Flags().StringVarP(&user, "name", "n", "", "the name of the user to be deleted")
+	deleteConfigUserCmd.MarkFlagRequired("name")
+	deleteConfigUserCmd.Flags().BoolVar(&force, "force", false, "delete the user even if contexts still use it")
+
+	deleteConfigServerCmd.Flags().StringVarP(&server, "name", "n", "", "the name of the server to be deleted")
+	deleteConfigServerCmd.MarkFlagRequired("name")
+	deleteConfigServerCmd.Flags().BoolVar(&force, "force", false, "delete the server even if contexts still use it")
+
+	deleteConfigContextCmd.Flags().StringVarP(&contextName, "name", "n", "", "the name of the context to be deleted")
+	deleteConfigContextCmd.MarkFlagRequired("name")
+	deleteConfigContextCmd.Flags().BoolVar(&force, "force", false, "delete the context even if it is the current-context")
+
+	renameConfigContextCmd.Flags().StringVarP(&contextName, "name", "n", "", "the name of the context to be renamed")
+	renameConfigContextCmd.MarkFlagRequired("name")
+	renameConfigContextCmd.Flags().StringVar(&newContextName, "to", "", "the new name of the context")
+	renameConfigContextCmd.MarkFlagRequired("to")
+
+	viewConfigCmd.Flags().BoolVar(&viewMerged, "merged", false, "show the config all config files add up to, and where each entry comes from")
+
 	rootCmd.AddCommand(configCmd)
 	configCmd.AddCommand(getConfigCmd)
+	configCmd.AddCommand(viewConfigCmd)
 	configCmd.AddCommand(currentContextCmd)
 	configCmd.AddCommand(getConfigUsersCmd)
 	configCmd.AddCommand(getConfigServersCmd)
@@ -50,6 +79,12 @@ func init() {
 	configCmd.AddCommand(setConfigServerCmd)
 	configCmd.AddCommand(setConfigContextCmd)
 	configCmd.AddCommand(useConfigContextCmd)
+	configCmd.AddCommand(migrateCredentialsCmd)
+	configCmd.AddCommand(deleteConfigUserCmd)
+	configCmd.AddCommand(deleteConfigServerCmd)
+	configCmd.AddCommand(deleteConfigContextCmd)
+	configCmd.AddCommand(renameConfigContextCmd)
+	configCmd.AddCommand(validateConfigCmd)
 }
 
 var configCmd = &cobra.Command{
@@ -84,10 +119,52 @@ var getConfigCmd = &cobra.Command{
 	},
 }
 
+var viewConfigCmd = &cobra.Command{
+	Use:   "view",
+	Short: "Display the config file written by config commands, or the merged config",
+	Long: `Display the config file written by config commands, or with --merged the
+config all config files add up to. From lowest to highest precedence, the config
+files are /etc/gospeckle/config.yaml (or $GOSPECKLE_SYSTEM_CONFIG), the user config
+in ~/.gospeckle/config.yaml, the closest .gospeckle.yaml found walking up from the
+working directory, and the --config file. Servers, users and contexts of a higher
+file replace those with the same name.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if viewMerged {
+			err := writeMergedConfig(os.Stdout)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		c, err := getConfig()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		err = printYaml(c)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
 var currentContextCmd = &cobra.Command{
 	Use:   "current-context",
 	Short: "Display the current context",
 	Run: func(cmd *cobra.Command, args []string) {
+		if resolved {
+			err := printResolvedContext()
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			return
+		}
+
 		c := getConfigContext()
 
 		err := printYaml(c)
@@ -102,7 +179,7 @@ var getConfigUsersCmd = &cobra.Command{
 	Use:   "get-user",
 	Short: "Display the current config users",
 	Run: func(cmd *cobra.Command, args []string) {
-		c, err := getConfig()
+		c, _, err := getMergedConfig()
 
 		if err != nil {
 			fmt.Println(err)
@@ -134,7 +211,7 @@ var getConfigServersCmd = &cobra.Command{
 	Use:   "get-server",
 	Short: "Display the current config servers",
 	Run: func(cmd *cobra.Command, args []string) {
-		c, err := getConfig()
+		c, _, err := getMergedConfig()
 
 		if err != nil {
 			fmt.Println(err)
@@ -166,7 +243,7 @@ var getConfigContextsCmd = &cobra.Command{
 	Use:   "get-context",
 	Short: "Display the current config contexts",
 	Run: func(cmd *cobra.Command, args []string) {
-		c, err := getConfig()
+		c, _, err := getMergedConfig()
 
 		if err != nil {
 			fmt.Println(err)
@@ -212,7 +289,11 @@ var setConfigUserCmd = &cobra.Command{
 				object.Email = email
 			}
 			if token != "" {
-				object.Token = token
+				err = saveUserToken(c, object, currentConfig.Server, token)
+				if err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
 			}
 			printYaml(object)
 
@@ -224,7 +305,13 @@ var setConfigUserCmd = &cobra.Command{
 			newUser := ConfigUser{
 				Name:  user,
 				Email: email,
-				Token: token,
+			}
+			if token != "" {
+				err = saveUserToken(c, &newUser, currentConfig.Server, token)
+				if err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
 			}
 			printYaml(newUser)
 
@@ -288,8 +375,10 @@ var setConfigContextCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
+		merged := mustGetMergedConfig()
+
 		if user != "" {
-			userObject, _ := c.getUserByName(user)
+			userObject, _ := merged.getUserByName(user)
 
 			if userObject == nil {
 				fmt.Println("user does not exist in config so cannot be assigned to context")
@@ -298,7 +387,7 @@ var setConfigContextCmd = &cobra.Command{
 		}
 
 		if server != "" {
-			serverObject, _ := c.getServerByName(server)
+			serverObject, _ := merged.getServerByName(server)
 
 			if serverObject == nil {
 				fmt.Println("server does not exist in config so cannot be assigned to context")
@@ -365,3 +454,242 @@ var useConfigContextCmd = &cobra.Command{
 		printYaml(c.CurrentContext)
 	},
 }
+
+var migrateCredentialsCmd = &cobra.Command{
+	Use:   "migrate-credentials",
+	Short: "Move the plaintext tokens of the config file to a credential store",
+	Long: `Move the plaintext tokens of the config file to a credential store.
+The config only keeps a reference to each token, and the store is saved as the
+config's credential-store so that later logins use it too.
+
+The file store encrypts tokens with the passphrase in $GOSPECKLE_PASSPHRASE, or
+with the key file named by $GOSPECKLE_KEY_FILE. The helper:<command> store runs an
+external credential helper using git's credential helper protocol.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := getConfig()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		if credentialStore != "" {
+			c.CredentialStore = credentialStore
+		}
+		if c.CredentialStore == "" {
+			fmt.Println("No credential store given, use --store file or --store helper:<command>")
+			os.Exit(1)
+		}
+
+		for i := range c.Users {
+			u := &c.Users[i]
+			if u.Token == "" || u.Credential != nil {
+				continue
+			}
+
+			err = saveUserToken(c, u, mustGetMergedConfig().userServer(u.Name), u.Token)
+			if err != nil {
+				fmt.Printf("Could not migrate user %v: %v\n", u.Name, err)
+				os.Exit(1)
+			}
+			fmt.Printf("Moved the token of user %v to %v\n", u.Name, c.CredentialStore)
+		}
+
+		viper.Set("credential-store", c.CredentialStore)
+		viper.Set("users", c.Users)
+		viper.WriteConfig()
+	},
+}
+
+var deleteConfigUserCmd = &cobra.Command{
+	Use:   "delete-user",
+	Short: "Delete a user from the current config file",
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := getConfig()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		err = checkWritable("user", user)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		object, err := c.getUserByName(user)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		used := contextsUsing(mustGetMergedConfig(), func(ctx ConfigContext) bool { return ctx.User == user })
+		if len(used) > 0 && !force {
+			fmt.Printf("user %v is used by the contexts %v, delete them first or use --force\n", user, used)
+			os.Exit(1)
+		}
+
+		if object.Credential != nil {
+			store, err := newCredentialStore(object.Credential.Store)
+			if err == nil {
+				err = store.Erase(object.Credential.Key)
+			}
+			if err != nil {
+				fmt.Printf("Could not erase the credential of user %v: %v\n", user, err)
+			}
+		}
+
+		var users []ConfigUser
+		for _, u := range c.Users {
+			if u.Name != user {
+				users = append(users, u)
+			}
+		}
+
+		viper.Set("users", users)
+		viper.WriteConfig()
+		fmt.Printf("Deleted user %v\n", user)
+	},
+}
+
+var deleteConfigServerCmd = &cobra.Command{
+	Use:   "delete-server",
+	Short: "Delete a server from the current config file",
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := getConfig()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		err = checkWritable("server", server)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		used := contextsUsing(mustGetMergedConfig(), func(ctx ConfigContext) bool { return ctx.Server == server })
+		if len(used) > 0 && !force {
+			fmt.Printf("server %v is used by the contexts %v, delete them first or use --force\n", server, used)
+			os.Exit(1)
+		}
+
+		var servers []ConfigServer
+		for _, s := range c.Servers {
+			if s.Name != server {
+				servers = append(servers, s)
+			}
+		}
+
+		viper.Set("servers", servers)
+		viper.WriteConfig()
+		fmt.Printf("Deleted server %v\n", server)
+	},
+}
+
+var deleteConfigContextCmd = &cobra.Command{
+	Use:   "delete-context",
+	Short: "Delete a context from the current config file",
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := getConfig()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		err = checkWritable("context", contextName)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		if c.CurrentContext == contextName {
+			if !force {
+				fmt.Printf("context %v is the current-context, switch to another one first or use --force\n", contextName)
+				os.Exit(1)
+			}
+			viper.Set("current-context", "")
+		}
+
+		var contexts []ConfigContext
+		for _, ctx := range c.Contexts {
+			if ctx.Name != contextName {
+				contexts = append(contexts, ctx)
+			}
+		}
+
+		viper.Set("contexts", contexts)
+		viper.WriteConfig()
+		fmt.Printf("Deleted context %v\n", contextName)
+	},
+}
+
+var renameConfigContextCmd = &cobra.Command{
+	Use:   "rename-context",
+	Short: "Rename a context in the current config file",
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := getConfig()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		err = checkWritable("context", contextName)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		object, err := c.getContextByName(contextName)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		if existing, _ := mustGetMergedConfig().getContextByName(newContextName); existing != nil {
+			fmt.Printf("context %v already exists\n", newContextName)
+			os.Exit(1)
+		}
+
+		object.Name = newContextName
+		if c.CurrentContext == contextName {
+			viper.Set("current-context", newContextName)
+		}
+
+		viper.Set("contexts", c.Contexts)
+		viper.WriteConfig()
+		fmt.Printf("Renamed context %v to %v\n", contextName, newContextName)
+	},
+}
+
+var validateConfigCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the config file for dangling references, duplicate names and invalid hosts",
+	Run: func(cmd *cobra.Command, args []string) {
+		c, _, err := getMergedConfig()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		problems := validateConfig(c)
+		for _, p := range problems {
+			fmt.Println(p)
+		}
+
+		if len(problems) > 0 {
+			os.Exit(1)
+		}
+		fmt.Println("The config is valid")
+	},
+}
+
+// contextsUsing returns the names of the contexts matching a predicate.
+func contextsUsing(c Config, match func(ctx ConfigContext) bool) []string {
+	var names []string
+	for _, ctx := range c.Contexts {
+		if match(ctx) {
+			names = append(names, ctx.Name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// validateConfig returns the problems found in a config: duplicate names, contexts
+// referencing missing users or servers, a missing current context, unparseable server
+// hosts and unknown credential stores.
+func validateConfig(c Config) []string {
+	var problems []string
+
+	servers := map[string]bool{}
+	for _, s := range c.Servers {
+		if servers[s.Name] {
+			problems = append(problems, fmt.Sprintf("server %q is defined more than once", s.Name))
+		}
+		servers[s.Name] = true
+
+		err := checkHost(s.Host)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("server %q: %v", s.Name, err))
+		}
+	}
+
+	users := map[string]bool{}
+	for _, u := range c.Users {
+		if users[u.Name] {
+			problems = append(problems, fmt.Sprintf("user %q is defined more than once", u.Name))
+		}
+		users[u.Name] = true
+
+		if u.Credential != nil {
+			_, err := newCredentialStore(u.Credential.Store)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("user %q: %v", u.Name, err))
+			}
+		}
+	}
+
+	contexts := map[string]bool{}
+	for _, ctx := range c.Contexts {
+		if contexts[ctx.Name] {
+			problems = append(problems, fmt.Sprintf("context %q is defined more than once", ctx.Name))
+		}
+		contexts[ctx.Name] = true
+
+		if !servers[ctx.Server] {
+			problems = append(problems, fmt.Sprintf("context %q references server %q, which does not exist", ctx.Name, ctx.Server))
+		}
+		if !users[ctx.User] {
+			problems = append(problems, fmt.Sprintf("context %q references user %q, which does not exist", ctx.Name, ctx.User))
+		}
+	}
+
+	if c.CurrentContext == "" {
+		problems = append(problems, "current-context is not set")
+	} else if !contexts[c.CurrentContext] {
+		problems = append(problems, fmt.Sprintf("current-context %q does not exist", c.CurrentContext))
+	}
+
+	if c.CredentialStore != "" {
+		_, err := newCredentialStore(c.CredentialStore)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("credential-store: %v", err))
+		}
+	}
+
+	return problems
+}
+
+// checkHost checks that a server host is an absolute http(s) URL.
+func checkHost(host string) error {
+	if host == "" {
+		return fmt.Errorf("host is empty")
+	}
+
+	u, err := url.Parse(host)
+	if err != nil {
+		return fmt.Errorf("host %q cannot be parsed: %v", host, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("host %q must start with http:// or https://", host)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("host %q has no hostname", host)
+	}
+
+	return nil
+}
+
+// checkCurrentContext explains why the resolved current context can't be used to
+// reach a server. Settings given through flags or environment variables don't need
+// to be found in the config.
+func checkCurrentContext(c Config, resolved ResolvedContext) error {
+	name := resolved.Context.Value
+
+	if resolved.Host.Source == sourceConfig || resolved.Host.Source == sourceUnset {
+		if name == "" {
+			return fmt.Errorf("no current context is set, use gospeckle config use-context or --server")
+		}
+
+		ctx, err := c.getContextByName(name)
+		if err != nil {
+			return fmt.Errorf("context %q does not exist in the config", name)
+		}
+
+		_, err = c.getServerByName(ctx.Server)
+		if err != nil {
+			return fmt.Errorf("context %q references server %q, which does not exist in the config", name, ctx.Server)
+		}
+	}
+
+	err := checkHost(resolved.Host.Value)
+	if err != nil {
+		return fmt.Errorf("context %q: %v", name, err)
+	}
+
+	if resolved.Token.Source == sourceConfig || resolved.Token.Source == sourceUnset {
+		ctx, err := c.getContextByName(name)
+		if err == nil {
+			_, err = c.getUserByName(ctx.User)
+			if err != nil {
+				return fmt.Errorf("context %q references user %q, which does not exist in the config", name, ctx.User)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,376 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Environment variables used to unlock the encrypted credential file.
+const (
+	passphraseEnv = "GOSPECKLE_PASSPHRASE"
+	keyFileEnv    = "GOSPECKLE_KEY_FILE"
+)
+
+const (
+	credentialFileVersion = 1
+	// pbkdf2Iterations follows the current OWASP recommendation for PBKDF2-HMAC-SHA256.
+	pbkdf2Iterations = 600000
+)
+
+// CredentialStore keeps user tokens outside of the config file. Tokens are stored
+// under a key identifying the user and the server they belong to.
+type CredentialStore interface {
+	Get(key string) (string, error)
+	Store(key string, token string) error
+	Erase(key string) error
+}
+
+// credentialKey returns the key a user's token is stored under, in the form of a URL
+// such as https://name@host, which is also what credential helpers are given.
+func credentialKey(user ConfigUser, server ConfigServer) string {
+	u, err := url.Parse(server.Host)
+	if err != nil || u.Host == "" {
+		u = &url.URL{Scheme: "gospeckle"}
+	}
+
+	key := url.URL{Scheme: u.Scheme, Host: u.Host, User: url.User(user.Name)}
+	if key.Host == "" {
+		key.Host = "default"
+	}
+	return key.String()
+}
+
+// newCredentialStore returns the store for a name: "file" for the encrypted
+// credential file, or "helper:<command>" for an external credential helper.
+func newCredentialStore(name string) (CredentialStore, error) {
+	switch {
+	case name == "file":
+		return newFileCredentialStore(), nil
+	case strings.HasPrefix(name, "helper:"):
+		helper := strings.TrimSpace(strings.TrimPrefix(name, "helper:"))
+		if strings.TrimSpace(strings.TrimPrefix(helper, "!")) == "" {
+			return nil, fmt.Errorf("credential store %q names no helper command", name)
+		}
+		return &helperCredentialStore{Helper: helper}, nil
+	}
+	return nil, fmt.Errorf("unknown credential store %q, expected file or helper:<command>", name)
+}
+
+// resolveUserToken returns a user's token, reading it from its credential store if
+// the config only holds a reference to it.
+func resolveUserToken(user ConfigUser) (string, error) {
+	if user.Credential == nil {
+		return user.Token, nil
+	}
+
+	store, err := newCredentialStore(user.Credential.Store)
+	if err != nil {
+		return "", err
+	}
+
+	return store.Get(user.Credential.Key)
+}
+
+// saveUserToken sets a user's token, storing it in the configured credential store,
+// or in plaintext in the config if there is none.
+func saveUserToken(config Config, user *ConfigUser, server ConfigServer, token string) error {
+	if config.CredentialStore == "" {
+		user.Token = token
+		user.Credential = nil
+		return nil
+	}
+
+	store, err := newCredentialStore(config.CredentialStore)
+	if err != nil {
+		return err
+	}
+
+	key := credentialKey(*user, server)
+	err = store.Store(key, token)
+	if err != nil {
+		return err
+	}
+
+	user.Token = ""
+	user.Credential = &CredentialRef{Store: config.CredentialStore, Key: key}
+	return nil
+}
+
+// fileCredentialStore keeps credentials in a file encrypted with AES-256-GCM. The key
+// is read from the key file named by GOSPECKLE_KEY_FILE, or derived from the
+// GOSPECKLE_PASSPHRASE passphrase with PBKDF2-HMAC-SHA256.
+type fileCredentialStore struct {
+	Path string
+}
+
+// credentialFile is the on-disk format of the encrypted credential file.
+type credentialFile struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations,omitempty"`
+	Salt       []byte `json:"salt,omitempty"`
+	Nonce      []byte `json:"nonce"`
+	Data       []byte `json:"data"`
+}
+
+func newFileCredentialStore() *fileCredentialStore {
+	merged, _, _ := getMergedConfig()
+	path := merged.CredentialFile
+	if path == "" {
+		path = filepath.Join(filepath.Dir(cfgFile), "credentials.enc")
+	}
+	return &fileCredentialStore{Path: path}
+}
+
+func (s *fileCredentialStore) Get(key string) (string, error) {
+	credentials, err := s.load()
+	if err != nil {
+		return "", err
+	}
+
+	token, ok := credentials[key]
+	if !ok {
+		return "", fmt.Errorf("no credential stored for %v in %v", key, s.Path)
+	}
+	return token, nil
+}
+
+func (s *fileCredentialStore) Store(key string, token string) error {
+	credentials, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	credentials[key] = token
+	return s.save(credentials)
+}
+
+func (s *fileCredentialStore) Erase(key string) error {
+	credentials, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	delete(credentials, key)
+	return s.save(credentials)
+}
+
+// load decrypts the credential file. A missing file holds no credentials.
+func (s *fileCredentialStore) load() (map[string]string, error) {
+	credentials := map[string]string{}
+
+	data, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return credentials, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var file credentialFile
+	err = json.Unmarshal(data, &file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read credential file %v: %v", s.Path, err)
+	}
+	if file.Version != credentialFileVersion {
+		return nil, fmt.Errorf("unsupported credential file version %v", file.Version)
+	}
+
+	key, err := credentialFileKey(file.KDF, file.Salt, file.Iterations)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := gcm.Open(nil, file.Nonce, file.Data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt credential file %v: wrong passphrase or key file", s.Path)
+	}
+
+	err = json.Unmarshal(plaintext, &credentials)
+	return credentials, err
+}
+
+// save encrypts the credentials with a new salt and nonce and writes them to the
+// credential file, readable by the current user only.
+func (s *fileCredentialStore) save(credentials map[string]string) error {
+	file := credentialFile{Version: credentialFileVersion, KDF: "keyfile"}
+
+	if os.Getenv(keyFileEnv) == "" {
+		file.KDF = "pbkdf2-sha256"
+		file.Iterations = pbkdf2Iterations
+		file.Salt = make([]byte, 16)
+		_, err := rand.Read(file.Salt)
+		if err != nil {
+			return err
+		}
+	}
+
+	key, err := credentialFileKey(file.KDF, file.Salt, file.Iterations)
+	if err != nil {
+		return err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+
+	file.Nonce = make([]byte, gcm.NonceSize())
+	_, err = rand.Read(file.Nonce)
+	if err != nil {
+		return err
+	}
+
+	plaintext, err := json.Marshal(credentials)
+	if err != nil {
+		return err
+	}
+	file.Data = gcm.Seal(nil, file.Nonce, plaintext, nil)
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(s.Path), 0700)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(s.Path, data, 0600)
+}
+
+// credentialFileKey returns the key the credential file is encrypted with.
+func credentialFileKey(kdf string, salt []byte, iterations int) ([]byte, error) {
+	switch kdf {
+	case "keyfile":
+		path := os.Getenv(keyFileEnv)
+		if path == "" {
+			return nil, fmt.Errorf("the credential file is encrypted with a key file, set %v", keyFileEnv)
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		data = bytes.TrimSpace(data)
+		if len(data) < 32 {
+			return nil, fmt.Errorf("key file %v must hold at least 32 bytes", path)
+		}
+
+		key := sha256.Sum256(data)
+		return key[:], nil
+	case "pbkdf2-sha256":
+		passphrase := os.Getenv(passphraseEnv)
+		if passphrase == "" {
+			return nil, fmt.Errorf("the credential file is encrypted with a passphrase, set %v", passphraseEnv)
+		}
+
+		return pbkdf2.Key([]byte(passphrase), salt, iterations, 32, sha256.New), nil
+	}
+	return nil, fmt.Errorf("unsupported credential file key derivation %q", kdf)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// helperCredentialStore delegates to an external credential helper, following the
+// protocol of git's credential.helper: the helper is run with get, store or erase as
+// its last argument and reads protocol, host, username and password attributes as
+// key=value lines on stdin. A helper that isn't a path is looked up as
+// gospeckle-credential-<name>, and one starting with ! is run as a shell command.
+type helperCredentialStore struct {
+	Helper string
+}
+
+func (s *helperCredentialStore) Get(key string) (string, error) {
+	out, err := s.run("get", key, "")
+	if err != nil {
+		return "", err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "password=") {
+			return strings.TrimPrefix(line, "password="), nil
+		}
+	}
+
+	return "", fmt.Errorf("credential helper %v returned no password for %v", s.Helper, key)
+}
+
+func (s *helperCredentialStore) Store(key string, token string) error {
+	_, err := s.run("store", key, token)
+	return err
+}
+
+func (s *helperCredentialStore) Erase(key string) error {
+	_, err := s.run("erase", key, "")
+	return err
+}
+
+func (s *helperCredentialStore) run(operation string, key string, token string) ([]byte, error) {
+	u, err := url.Parse(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var input bytes.Buffer
+	fmt.Fprintf(&input, "protocol=%v\n", u.Scheme)
+	fmt.Fprintf(&input, "host=%v\n", u.Host)
+	if u.User != nil {
+		fmt.Fprintf(&input, "username=%v\n", u.User.Username())
+	}
+	if token != "" {
+		fmt.Fprintf(&input, "password=%v\n", token)
+	}
+	input.WriteString("\n")
+
+	var command *exec.Cmd
+	if strings.HasPrefix(s.Helper, "!") {
+		command = exec.Command("sh", "-c", strings.TrimPrefix(s.Helper, "!")+` "$@"`, s.Helper, operation)
+	} else {
+		args := strings.Fields(s.Helper)
+		if len(args) == 0 {
+			return nil, fmt.Errorf("credential helper %q names no command", s.Helper)
+		}
+		if !strings.ContainsRune(args[0], filepath.Separator) {
+			args[0] = "gospeckle-credential-" + args[0]
+		}
+		command = exec.Command(args[0], append(args[1:], operation)...)
+	}
+
+	command.Stdin = &input
+	command.Stderr = os.Stderr
+
+	out, err := command.Output()
+	if err != nil {
+		return nil, fmt.Errorf("credential helper %v %v failed: %v", s.Helper, operation, err)
+	}
+	return out, nil
+}
@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	gospeckle "github.com/speckleworks/gospeckle/pkg"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+
+	diffCmd.Flags().StringArrayVarP(&filenames, "filename", "f", nil, "file, directory or glob to read speckle resources from (\"-\" reads stdin, can be repeated)")
+	diffCmd.Flags().BoolVarP(&recursive, "recursive", "R", false, "process the directories passed to --filename recursively")
+	diffCmd.MarkFlagRequired("filename")
+}
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "show what apply would change on a speckle server",
+	Long: `Compares resource files with the resources on the current context's server and
+prints what apply would change. Resources without an id would be created. For the
+others, only the fields set in the file are compared, since apply leaves the other
+fields as they are.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		requestObjects, err := parseResourceFiles(filenames, recursive)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		err = diffResources(requestObjects)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+// diffResources prints the changes applying resources would make.
+func diffResources(r RequestObjects) error {
+	for _, item := range r.Projects {
+		item := item
+		err := diffResource("project", item.ID, item.Name, item.ProjectRequest, func() (interface{}, error) {
+			p, _, err := speckleClient.Project.Get(ctx, item.ID)
+			return p.Request(), err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, item := range r.Streams {
+		item := item
+		err := diffResource("stream", item.ID, item.Name, item.StreamRequest, func() (interface{}, error) {
+			s, _, err := speckleClient.Stream.Get(ctx, item.ID)
+			return s.Request(), err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, item := range r.Clients {
+		item := item
+		err := diffResource("client", item.ID, item.DocumentName, item.APIClientRequest, func() (interface{}, error) {
+			c, _, err := speckleClient.APIClient.Get(ctx, item.ID)
+			return c.Request(), err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// diffResource prints the changes applying a resource would make, fetching its
+// current state with get.
+func diffResource(kind string, id string, name string, desired interface{}, get func() (interface{}, error)) error {
+	if id == "" {
+		fmt.Printf("+ %v %q would be created\n", kind, name)
+		return nil
+	}
+
+	current, err := get()
+	if err != nil {
+		return fmt.Errorf("%v %v: %v", kind, id, err)
+	}
+
+	desiredFields, err := jsonFields(desired)
+	if err != nil {
+		return err
+	}
+	currentFields, err := jsonFields(current)
+	if err != nil {
+		return err
+	}
+
+	// Fields the file doesn't set aren't sent by apply, so they don't change.
+	compared := map[string]interface{}{}
+	for k := range desiredFields {
+		compared[k] = currentFields[k]
+	}
+
+	changes := gospeckle.DiffJSON(compared, desiredFields)
+	if len(changes) == 0 {
+		fmt.Printf("= %v %v %q is unchanged\n", kind, id, name)
+		return nil
+	}
+
+	fmt.Printf("~ %v %v %q would be updated\n", kind, id, name)
+	printPropertyChanges(changes)
+	return nil
+}
+
+// jsonFields returns the fields a request payload sends to the server.
+func jsonFields(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]interface{}{}
+	err = json.Unmarshal(data, &fields)
+	return fields, err
+}
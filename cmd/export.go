@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+var owner string
+var outputDir string
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+
+	exportManifestsCmd.Flags().StringVar(&owner, "owner", "", "only export resources owned by this account ID (\"me\" for the current user)")
+	exportManifestsCmd.Flags().StringVarP(&outputDir, "dir", "d", ".", "the directory to write manifests to")
+	exportManifestsCmd.Flags().BoolVar(&withIDs, "with-ids", false, "keep resource IDs in manifests so applying them updates the existing resources")
+	exportCmd.AddCommand(exportManifestsCmd)
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export speckle resources from the server",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var exportManifestsCmd = &cobra.Command{
+	Use:   "manifests",
+	Short: "Export projects, streams and clients as manifests that can be applied",
+	Long: `Export projects, streams and clients as manifests that can be applied.
+
+One file is written per resource under <dir>/projects, <dir>/streams and <dir>/clients.
+The whole directory can be re-applied with "gospeckle apply -R -f <dir>".`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ownerID := owner
+		if owner == "me" {
+			me, _, err := speckleClient.Account.Me(ctx)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			ownerID = me.ID
+		}
+
+		projects, _, err := speckleClient.Project.List(ctx)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		streams, _, err := speckleClient.Stream.List(ctx)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		clients, _, err := speckleClient.APIClient.List(ctx)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		count := 0
+		write := func(kind string, id string, m FileInput) {
+			path := filepath.Join(outputDir, kind+"s", id+".yaml")
+			err := writeManifestFile(path, m)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			count++
+		}
+
+		for _, p := range projects {
+			if ownerID != "" && p.Owner != ownerID {
+				continue
+			}
+			m, err := projectManifest(p, withIDs)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			write("project", p.ID, m)
+		}
+
+		for _, s := range streams {
+			if ownerID != "" && s.Owner != ownerID {
+				continue
+			}
+			m, err := streamManifest(s, withIDs)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			write("stream", s.StreamID, m)
+		}
+
+		for _, c := range clients {
+			if ownerID != "" && c.Owner != ownerID {
+				continue
+			}
+			m, err := clientManifest(c, withIDs)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			write("client", c.ID, m)
+		}
+
+		fmt.Printf("Exported %d manifest(s) to %v\n", count, outputDir)
+	},
+}
+
+// writeManifestFile writes a single manifest to path, creating its directory if needed.
+func writeManifestFile(path string, m FileInput) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return writeManifests(f, []FileInput{m})
+}
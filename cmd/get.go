@@ -16,6 +16,8 @@ var streamID string
 var admin bool
 var object interface{}
 var err error
+var outputFormat string
+var withIDs bool
 
 func init() {
 	rootCmd.AddCommand(getCmd)
@@ -26,12 +28,15 @@ func init() {
 	getCmd.AddCommand(getAccountCmd)
 
 	getAPIClientCmd.Flags().StringVar(&streamID, "stream", "", "the search streamId of the stream to list clients for")
+	addManifestFlags(getAPIClientCmd)
 	getCmd.AddCommand(getAPIClientCmd)
 
 	getProjectCmd.Flags().BoolVar(&admin, "admin", false, "run this command as administrator")
+	addManifestFlags(getProjectCmd)
 	getCmd.AddCommand(getProjectCmd)
 
 	getStreamCmd.Flags().BoolVar(&admin, "admin", false, "run this command as administrator")
+	addManifestFlags(getStreamCmd)
 	getCmd.AddCommand(getStreamCmd)
 
 	getObjectCmd.Flags().StringVarP(&search, "search", "s", "", "the search string to find speckle objects")
@@ -52,6 +57,12 @@ func init() {
 
 }
 
+// addManifestFlags adds the flags used to print resources as apply manifests.
+func addManifestFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "json", "output format (json|manifest)")
+	cmd.Flags().BoolVar(&withIDs, "with-ids", false, "keep resource IDs in manifests so applying them updates the existing resources")
+}
+
 var getCmd = &cobra.Command{
 	Use:   "get",
 	Short: "Get one or a list of speckle resources",
@@ -126,7 +137,7 @@ var getAPIClientCmd = &cobra.Command{
 				os.Exit(1)
 			}
 		}
-		err := printJSON(object)
+		err := printResource(object, outputFormat)
 		if err != nil {
 			fmt.Println(err)
 			os.Exit(1)
@@ -166,7 +177,7 @@ var getProjectCmd = &cobra.Command{
 				os.Exit(1)
 			}
 		}
-		err := printJSON(object)
+		err := printResource(object, outputFormat)
 		if err != nil {
 			fmt.Println(err)
 			os.Exit(1)
@@ -218,7 +229,7 @@ var getStreamCmd = &cobra.Command{
 			}
 		}
 
-		err := printJSON(object)
+		err := printResource(object, outputFormat)
 		if err != nil {
 			fmt.Println(err)
 			os.Exit(1)
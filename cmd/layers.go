@@ -0,0 +1,336 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/viper"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Config layers, from lowest to highest precedence.
+const (
+	layerSystem  = "system"
+	layerUser    = "user"
+	layerProject = "project"
+	layerFlag    = "flag"
+)
+
+// systemConfigEnv overrides the path of the system-wide config file.
+const systemConfigEnv = "GOSPECKLE_SYSTEM_CONFIG"
+
+const (
+	defaultSystemConfigPath = "/etc/gospeckle/config.yaml"
+	projectConfigName       = ".gospeckle.yaml"
+)
+
+// configLayer is one of the config files merged into the config used by commands.
+type configLayer struct {
+	Name string
+	Path string
+	// Found is false if the file doesn't exist.
+	Found bool
+	// Writable is set on the layer that config commands edit, which is the --config
+	// file if given and the user config otherwise.
+	Writable bool
+	Config   Config
+}
+
+// layerPaths are the config files found by initConfig, set before any command runs.
+var layerPaths []configLayer
+
+// findConfigLayers returns the config files merged into the config, whether they
+// exist or not: the system-wide file, the user config, the closest .gospeckle.yaml
+// walking up from the working directory, and the --config file. writable is the path
+// of the file viper reads and writes.
+func findConfigLayers(userPath string, flagPath string, writable string) []configLayer {
+	systemPath := os.Getenv(systemConfigEnv)
+	if systemPath == "" {
+		systemPath = defaultSystemConfigPath
+	}
+
+	layers := []configLayer{
+		{Name: layerSystem, Path: systemPath},
+		{Name: layerUser, Path: userPath},
+	}
+
+	if path := findProjectConfig(); path != "" {
+		layers = append(layers, configLayer{Name: layerProject, Path: path})
+	}
+	if flagPath != "" {
+		layers = append(layers, configLayer{Name: layerFlag, Path: flagPath})
+	}
+
+	writable = absPath(writable)
+
+	// Without --config, viper may have found the user config in the working directory
+	// instead of the home directory.
+	if flagPath == "" {
+		layers[1].Path = writable
+	}
+
+	var unique []configLayer
+	seen := map[string]bool{}
+	for i := len(layers) - 1; i >= 0; i-- {
+		path := absPath(layers[i].Path)
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+
+		layers[i].Writable = path == writable
+		unique = append([]configLayer{layers[i]}, unique...)
+	}
+
+	return unique
+}
+
+// findProjectConfig returns the path of the closest .gospeckle.yaml in the working
+// directory or its parents, or an empty string if there is none.
+func findProjectConfig() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+
+	for {
+		path := filepath.Join(dir, projectConfigName)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+func absPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	return abs
+}
+
+// readConfigLayers reads every config layer. The writable layer is taken from viper,
+// so that it reflects changes made by the running command.
+func readConfigLayers() ([]configLayer, error) {
+	layers := make([]configLayer, len(layerPaths))
+	copy(layers, layerPaths)
+
+	for i := range layers {
+		l := &layers[i]
+
+		if l.Writable {
+			c, err := getConfig()
+			if err != nil {
+				return nil, fmt.Errorf("%v config %v: %v", l.Name, l.Path, err)
+			}
+			l.Config = c
+			l.Found = true
+			continue
+		}
+
+		data, err := ioutil.ReadFile(l.Path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		err = yaml.Unmarshal(data, &l.Config)
+		if err != nil {
+			return nil, fmt.Errorf("%v config %v: %v", l.Name, l.Path, err)
+		}
+		l.Found = true
+	}
+
+	return layers, nil
+}
+
+// getMergedConfig returns the config all layers add up to, and the layer each setting,
+// server, user and context comes from. Settings of a higher layer replace those of a
+// lower one, and servers, users and contexts replace those with the same name.
+func getMergedConfig() (Config, map[string]configLayer, error) {
+	layers, err := readConfigLayers()
+	if err != nil {
+		return Config{}, nil, err
+	}
+
+	merged, origins := mergeConfigLayers(layers)
+	return merged, origins, nil
+}
+
+func mergeConfigLayers(layers []configLayer) (Config, map[string]configLayer) {
+	var merged Config
+	origins := map[string]configLayer{}
+
+	for _, l := range layers {
+		if !l.Found {
+			continue
+		}
+		c := l.Config
+
+		if c.CurrentContext != "" {
+			merged.CurrentContext = c.CurrentContext
+			origins["current-context"] = l
+		}
+		if c.CredentialStore != "" {
+			merged.CredentialStore = c.CredentialStore
+			origins["credential-store"] = l
+		}
+		if c.CredentialFile != "" {
+			merged.CredentialFile = c.CredentialFile
+			origins["credential-file"] = l
+		}
+
+		for _, s := range c.Servers {
+			if existing, err := merged.getServerByName(s.Name); err == nil {
+				*existing = s
+			} else {
+				merged.Servers = append(merged.Servers, s)
+			}
+			origins["servers/"+s.Name] = l
+		}
+
+		for _, u := range c.Users {
+			if existing, err := merged.getUserByName(u.Name); err == nil {
+				*existing = u
+			} else {
+				merged.Users = append(merged.Users, u)
+			}
+			origins["users/"+u.Name] = l
+		}
+
+		for _, ctx := range c.Contexts {
+			if existing, err := merged.getContextByName(ctx.Name); err == nil {
+				*existing = ctx
+			} else {
+				merged.Contexts = append(merged.Contexts, ctx)
+			}
+			origins["contexts/"+ctx.Name] = l
+		}
+	}
+
+	return merged, origins
+}
+
+// mustGetMergedConfig returns the merged config, exiting if a layer can't be read.
+func mustGetMergedConfig() Config {
+	c, _, err := getMergedConfig()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	return c
+}
+
+// checkWritable explains that an entry can't be edited because it is defined in a
+// layer other than the one config commands write to.
+func checkWritable(kind string, name string) error {
+	_, origins, err := getMergedConfig()
+	if err != nil {
+		return err
+	}
+
+	l, ok := origins[kind+"s/"+name]
+	if !ok {
+		return fmt.Errorf("Could not find %v with name: %v", kind, name)
+	}
+	if l.Writable {
+		return nil
+	}
+	return fmt.Errorf("%v %v is defined in the %v config %v, edit it there or select it with --config", kind, name, l.Name, l.Path)
+}
+
+// writeMergedConfig prints the merged config, annotating every entry with the layer
+// it comes from.
+func writeMergedConfig(w io.Writer) error {
+	layers, err := readConfigLayers()
+	if err != nil {
+		return err
+	}
+	merged, origins := mergeConfigLayers(layers)
+
+	fmt.Fprintln(w, "# layers, from lowest to highest precedence:")
+	for _, l := range layers {
+		status := ""
+		if !l.Found {
+			status = " (not found)"
+		} else if l.Writable {
+			status = " (written by config commands)"
+		}
+		fmt.Fprintf(w, "#   %-8v %v%v\n", l.Name, l.Path, status)
+	}
+
+	origin := func(key string) string {
+		return "# from " + origins[key].Name
+	}
+
+	scalars := []struct {
+		key   string
+		value string
+	}{
+		{"current-context", merged.CurrentContext},
+		{"credential-store", merged.CredentialStore},
+		{"credential-file", merged.CredentialFile},
+	}
+	for _, s := range scalars {
+		if s.value == "" {
+			continue
+		}
+		fmt.Fprintf(w, "%v: %v  %v\n", s.key, s.value, origin(s.key))
+	}
+
+	writeEntry := func(key string, entry interface{}) error {
+		data, err := yaml.Marshal([]interface{}{entry})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, origin(key))
+		fmt.Fprint(w, string(data))
+		return nil
+	}
+
+	fmt.Fprintln(w, "servers:")
+	for _, s := range merged.Servers {
+		err = writeEntry("servers/"+s.Name, s)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintln(w, "users:")
+	for _, u := range merged.Users {
+		err = writeEntry("users/"+u.Name, u)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintln(w, "contexts:")
+	for _, ctx := range merged.Contexts {
+		err = writeEntry("contexts/"+ctx.Name, ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writableConfigPath returns the path of the config file viper writes to.
+func writableConfigPath() string {
+	path := viper.ConfigFileUsed()
+	if path == "" {
+		path = cfgFile
+	}
+	return path
+}
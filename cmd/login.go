@@ -59,8 +59,23 @@ var loginCmd = &cobra.Command{
 		}
 
 		user, err := config.getUserByName(currentConfig.User.Name)
+		if err != nil {
+			// The user is defined in another config layer, so it is overridden in the
+			// config file being written.
+			shared, mergedErr := mustGetMergedConfig().getUserByName(currentConfig.User.Name)
+			if mergedErr != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			config.Users = append(config.Users, *shared)
+			user = &config.Users[len(config.Users)-1]
+		}
 
-		user.Token = speckleClient.Token
+		err = saveUserToken(config, user, currentConfig.Server, speckleClient.Token)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
 
 		viper.Set("users", config.Users)
 		viper.WriteConfig()
@@ -102,7 +117,12 @@ var registerCmd = &cobra.Command{
 		newConfigUser := ConfigUser{
 			Name:  userName,
 			Email: email,
-			Token: speckleClient.Token,
+		}
+
+		err = saveUserToken(config, &newConfigUser, currentConfig.Server, speckleClient.Token)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
 		}
 
 		serverName := currentConfig.Server.Name
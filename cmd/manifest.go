@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	gospeckle "github.com/speckleworks/gospeckle/pkg"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// serverManagedSpecKeys are spec fields that describe a resource's data or history on
+// one particular server rather than its configuration, so they are left out of manifests.
+var serverManagedSpecKeys = []string{"objects", "parents", "children", "commit"}
+
+// requestMetadataKeys are the fields of RequestMetadata, which manifests hold under
+// metadata rather than spec.
+var requestMetadataKeys = []string{"private", "canRead", "canWrite", "anonymousComments"}
+
+// projectManifest converts a project returned by the server into the resource file
+// format read by apply.
+func projectManifest(p gospeckle.Project, withID bool) (FileInput, error) {
+	return newManifest("project", p.ID, withID, p.Metadata, p.Request())
+}
+
+// streamManifest converts a stream returned by the server into the resource file
+// format read by apply.
+func streamManifest(s gospeckle.Stream, withID bool) (FileInput, error) {
+	return newManifest("stream", s.StreamID, withID, s.Metadata, s.Request())
+}
+
+// clientManifest converts an api client returned by the server into the resource file
+// format read by apply.
+func clientManifest(c gospeckle.APIClient, withID bool) (FileInput, error) {
+	return newManifest("client", c.ID, withID, c.Metadata, c.Request())
+}
+
+func newManifest(kind string, id string, withID bool, metadata gospeckle.Metadata, request interface{}) (FileInput, error) {
+	m := FileInput{
+		Type:     kind,
+		Metadata: metadata.Request(),
+	}
+
+	if withID {
+		m.ID = id
+	}
+
+	data, err := json.Marshal(request)
+	if err != nil {
+		return m, err
+	}
+
+	spec := map[string]interface{}{}
+	err = json.Unmarshal(data, &spec)
+	if err != nil {
+		return m, err
+	}
+
+	for _, k := range append(requestMetadataKeys, serverManagedSpecKeys...) {
+		delete(spec, k)
+	}
+
+	for k, v := range spec {
+		if v == nil {
+			delete(spec, k)
+		}
+	}
+
+	m.Spec = spec
+	return m, nil
+}
+
+// toManifests converts the resources returned by a get command into manifests.
+func toManifests(object interface{}, withID bool) ([]FileInput, error) {
+	var manifests []FileInput
+
+	switch o := object.(type) {
+	case gospeckle.Project:
+		return toManifests([]gospeckle.Project{o}, withID)
+	case gospeckle.Stream:
+		return toManifests([]gospeckle.Stream{o}, withID)
+	case gospeckle.APIClient:
+		return toManifests([]gospeckle.APIClient{o}, withID)
+	case []gospeckle.Project:
+		for _, p := range o {
+			m, err := projectManifest(p, withID)
+			if err != nil {
+				return nil, err
+			}
+			manifests = append(manifests, m)
+		}
+	case []gospeckle.Stream:
+		for _, s := range o {
+			m, err := streamManifest(s, withID)
+			if err != nil {
+				return nil, err
+			}
+			manifests = append(manifests, m)
+		}
+	case []gospeckle.APIClient:
+		for _, c := range o {
+			m, err := clientManifest(c, withID)
+			if err != nil {
+				return nil, err
+			}
+			manifests = append(manifests, m)
+		}
+	default:
+		return nil, fmt.Errorf("cannot convert %T to a manifest", object)
+	}
+
+	return manifests, nil
+}
+
+// writeManifests writes manifests as a stream of YAML documents.
+func writeManifests(w io.Writer, manifests []FileInput) error {
+	for i, m := range manifests {
+		if i > 0 {
+			if _, err := fmt.Fprintln(w, "---"); err != nil {
+				return err
+			}
+		}
+
+		data, err := yaml.Marshal(m)
+		if err != nil {
+			return err
+		}
+
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// printResource prints the result of a get command in the requested output format.
+func printResource(object interface{}, format string) error {
+	switch format {
+	case "", "json":
+		return printJSON(object)
+	case "manifest":
+		manifests, err := toManifests(object, withIDs)
+		if err != nil {
+			return err
+		}
+		return writeManifests(os.Stdout, manifests)
+	default:
+		return fmt.Errorf("unknown output format: %v", format)
+	}
+}
@@ -0,0 +1,676 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	gospeckle "github.com/speckleworks/gospeckle/pkg"
+	"github.com/spf13/cobra"
+)
+
+// Kinds of entries in a migration checkpoint.
+const (
+	migrationHeader         = "migration"
+	migrationAccount        = "account"
+	migrationUnmapped       = "unmapped"
+	migrationProject        = "project"
+	migrationProjectComment = "project-comment"
+	migrationProjectUser    = "project-user"
+	migrationStreamItem     = "stream-item"
+	migrationStream         = "stream"
+	migrationClient         = "client"
+)
+
+var migrateFrom string
+var migrateTo string
+var migrateProject string
+var migrateCheckpoint string
+
+func init() {
+	migrateCmd.Flags().StringVar(&migrateFrom, "from", "", "the context of the server to migrate from")
+	migrateCmd.Flags().StringVar(&migrateTo, "to", "", "the context of the server to migrate to")
+	migrateCmd.Flags().StringVar(&migrateProject, "project", "", "the ID of the project to migrate")
+	migrateCmd.Flags().StringVar(&migrateCheckpoint, "checkpoint", "", "the checkpoint file (default gospeckle-migrate-<project>.jsonl)")
+	migrateCmd.MarkFlagRequired("from")
+	migrateCmd.MarkFlagRequired("to")
+	migrateCmd.MarkFlagRequired("project")
+
+	rootCmd.AddCommand(migrateCmd)
+}
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Copy a project with its streams, objects, comments and clients to another server",
+	Long: `Copies a project, its streams with their objects and layers, the comments on all
+of them and the streams' clients from the server of one context to the server of
+another.
+
+Accounts in permissions and comment assignees are mapped to the accounts of the
+target server with the same email. Accounts that can't be mapped are dropped and
+reported. Owners are the account of the --to context, and parents and children
+of streams aren't copied.
+
+Everything created is recorded in a checkpoint file, so an interrupted migration
+resumes where it stopped and running it again doesn't copy anything twice.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		path := migrateCheckpoint
+		if path == "" {
+			path = "gospeckle-migrate-" + migrateProject + ".jsonl"
+		}
+
+		src, err := newContextClient(migrateFrom)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		dst, err := newContextClient(migrateTo)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		// Objects are only downloaded from the source, so the target doesn't use the
+		// object store.
+		store, err := newObjectStore()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if store != nil {
+			src.SetObjectStore(store)
+		}
+
+		cp, err := openMigrationCheckpoint(path, migrateFrom, migrateTo, migrateProject)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		defer cp.Close()
+
+		m := &migration{src: src, dst: dst, cp: cp}
+		err = m.run(ctx, migrateProject)
+		if err != nil {
+			fmt.Println(err)
+			fmt.Printf("The migration can be resumed by running the same command, progress is saved in %v\n", path)
+			os.Exit(1)
+		}
+
+		m.printReport()
+	},
+}
+
+// newContextClient returns a client for a context of the config, other than the
+// current one.
+func newContextClient(name string) (*gospeckle.Client, error) {
+	config, _, err := getMergedConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := config.getContextByName(name)
+	if err != nil {
+		return nil, err
+	}
+	server, err := config.getServerByName(c.Server)
+	if err != nil {
+		return nil, fmt.Errorf("context %v: %v", name, err)
+	}
+	user, err := config.getUserByName(c.User)
+	if err != nil {
+		return nil, fmt.Errorf("context %v: %v", name, err)
+	}
+
+	token, err := resolveUserToken(*user)
+	if err != nil {
+		return nil, fmt.Errorf("context %v: %v", name, err)
+	}
+
+	host, err := url.Parse(server.Host)
+	if err != nil {
+		return nil, fmt.Errorf("context %v: %v", name, err)
+	}
+
+	return gospeckle.NewClient(new(http.Client), host, nil, server.Version, token), nil
+}
+
+// migrationEntry is a line of a migration checkpoint, recording that a resource of
+// the source server was copied to the target server as NewID.
+type migrationEntry struct {
+	Kind  string `json:"kind"`
+	ID    string `json:"id"`
+	NewID string `json:"newId,omitempty"`
+	// Email is the email of a source account.
+	Email string `json:"email,omitempty"`
+	// Resource is the resource an unmapped account was dropped from.
+	Resource string `json:"resource,omitempty"`
+	// Objects and Comments are the number of objects and comments of a migrated stream.
+	Objects  int `json:"objects,omitempty"`
+	Comments int `json:"comments,omitempty"`
+	// From and To are the contexts of a migration header.
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+// migrationCheckpoint is an append-only log of the resources a migration created,
+// one JSON entry per line, so that nothing but the resource being created when it is
+// interrupted is lost.
+type migrationCheckpoint struct {
+	file     *os.File
+	ids      map[string]map[string]string
+	emails   map[string]string
+	unmapped map[string][]string
+
+	// objects and comments count the objects and comments of the migrated streams.
+	objects  int
+	comments int
+}
+
+// openMigrationCheckpoint opens the checkpoint of a migration, creating it if it
+// doesn't exist, and replays its entries.
+func openMigrationCheckpoint(path string, from string, to string, project string) (*migrationCheckpoint, error) {
+	cp := &migrationCheckpoint{
+		ids:      map[string]map[string]string{},
+		emails:   map[string]string{},
+		unmapped: map[string][]string{},
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	cp.file = f
+
+	header := migrationEntry{Kind: migrationHeader, ID: project, From: from, To: to}
+	empty := true
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e migrationEntry
+		err = json.Unmarshal(scanner.Bytes(), &e)
+		if err != nil {
+			// The last line is partial if the migration was killed while writing it.
+			continue
+		}
+
+		if e.Kind == migrationHeader {
+			if e != header {
+				f.Close()
+				return nil, fmt.Errorf("%v is the checkpoint of the migration of project %v from %v to %v", path, e.ID, e.From, e.To)
+			}
+			empty = false
+			continue
+		}
+		cp.replay(e)
+	}
+	if err = scanner.Err(); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if empty {
+		err = cp.write(header)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+	} else {
+		err = terminateLastLine(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	return cp, nil
+}
+
+func (cp *migrationCheckpoint) replay(e migrationEntry) {
+	switch e.Kind {
+	case migrationUnmapped:
+		if !contains(cp.unmapped[e.ID], e.Resource) {
+			cp.unmapped[e.ID] = append(cp.unmapped[e.ID], e.Resource)
+		}
+	case migrationStream:
+		if _, ok := cp.ids[e.Kind][e.ID]; !ok {
+			cp.objects += e.Objects
+			cp.comments += e.Comments
+		}
+		fallthrough
+	default:
+		if cp.ids[e.Kind] == nil {
+			cp.ids[e.Kind] = map[string]string{}
+		}
+		cp.ids[e.Kind][e.ID] = e.NewID
+		if e.Email != "" {
+			cp.emails[e.ID] = e.Email
+		}
+	}
+}
+
+// terminateLastLine ends a partial last line, so that the next entry starts on a line
+// of its own.
+func terminateLastLine(f *os.File) error {
+	info, err := f.Stat()
+	if err != nil || info.Size() == 0 {
+		return err
+	}
+
+	last := make([]byte, 1)
+	_, err = f.ReadAt(last, info.Size()-1)
+	if err != nil || last[0] == '\n' {
+		return err
+	}
+
+	_, err = f.Write([]byte{'\n'})
+	return err
+}
+
+func (cp *migrationCheckpoint) write(e migrationEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	_, err = cp.file.Write(append(data, '\n'))
+	if err != nil {
+		return err
+	}
+	return cp.file.Sync()
+}
+
+// record saves that a resource was copied.
+func (cp *migrationCheckpoint) record(e migrationEntry) error {
+	cp.replay(e)
+	return cp.write(e)
+}
+
+// get returns the ID a resource was copied as.
+func (cp *migrationCheckpoint) get(kind string, id string) (string, bool) {
+	newID, ok := cp.ids[kind][id]
+	return newID, ok
+}
+
+func (cp *migrationCheckpoint) Close() error {
+	return cp.file.Close()
+}
+
+// migration copies a project from the src to the dst server.
+type migration struct {
+	src *gospeckle.Client
+	dst *gospeckle.Client
+	cp  *migrationCheckpoint
+
+	// skipped are the resources that couldn't be copied.
+	skipped []string
+}
+
+func (m *migration) run(ctx context.Context, projectID string) error {
+	project, _, err := m.src.Project.Get(ctx, projectID)
+	if err != nil {
+		return err
+	}
+
+	err = m.mapAccounts(ctx, "project "+project.ID, project.CanRead, project.CanWrite, project.Permissions.CanRead, project.Permissions.CanWrite)
+	if err != nil {
+		return err
+	}
+
+	newProjectID, ok := m.cp.get(migrationProject, project.ID)
+	if !ok {
+		request := project.Request()
+		request.CanRead = m.remap(project.CanRead)
+		request.CanWrite = m.remap(project.CanWrite)
+		request.Streams = nil
+
+		created, _, err := m.dst.Project.Create(ctx, request)
+		if err != nil {
+			return fmt.Errorf("creating project %v: %v", project.ID, err)
+		}
+		newProjectID = created.ID
+
+		err = m.cp.record(migrationEntry{Kind: migrationProject, ID: project.ID, NewID: newProjectID})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Created project %v as %v\n", project.ID, newProjectID)
+	}
+
+	err = m.migrateProjectUsers(ctx, project, newProjectID)
+	if err != nil {
+		return err
+	}
+
+	err = m.migrateProjectComments(ctx, project.ID, newProjectID)
+	if err != nil {
+		return err
+	}
+
+	for _, streamID := range project.Streams {
+		err = m.migrateStream(ctx, streamID, newProjectID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return m.migrateClients(ctx, project.Streams)
+}
+
+// migrateProjectUsers gives the accounts of the project's permissions the same access
+// to the new project.
+func (m *migration) migrateProjectUsers(ctx context.Context, project gospeckle.Project, newProjectID string) error {
+	canWrite := map[string]bool{}
+	for _, id := range project.Permissions.CanWrite {
+		canWrite[id] = true
+	}
+
+	users := append(append([]string{}, project.Permissions.CanRead...), project.Permissions.CanWrite...)
+	for _, id := range users {
+		newID := m.cp.ids[migrationAccount][id]
+		if newID == "" {
+			continue
+		}
+		if _, ok := m.cp.get(migrationProjectUser, id); ok {
+			continue
+		}
+
+		_, err := m.dst.Project.AddUser(ctx, newProjectID, newID)
+		if err != nil {
+			return fmt.Errorf("adding %v to project %v: %v", newID, newProjectID, err)
+		}
+		if canWrite[id] {
+			_, err = m.dst.Project.UpgradeUser(ctx, newProjectID, newID)
+			if err != nil {
+				return fmt.Errorf("giving %v write access to project %v: %v", newID, newProjectID, err)
+			}
+		}
+
+		err = m.cp.record(migrationEntry{Kind: migrationProjectUser, ID: id, NewID: newID})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *migration) migrateProjectComments(ctx context.Context, projectID string, newProjectID string) error {
+	comments, _, err := m.src.ListArchivedComments(ctx, "projects", projectID)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range comments {
+		if _, ok := m.cp.get(migrationProjectComment, c.ID); ok {
+			continue
+		}
+
+		err = m.mapAccounts(ctx, "comment "+c.ID, c.CanRead, c.CanWrite, c.AssignedTo)
+		if err != nil {
+			return err
+		}
+
+		request := c
+		request.CanRead = m.remap(c.CanRead)
+		request.CanWrite = m.remap(c.CanWrite)
+		request.AssignedTo = m.remap(c.AssignedTo)
+
+		created, _, err := m.dst.CreateArchivedComment(ctx, "projects", newProjectID, request)
+		if err != nil {
+			return fmt.Errorf("creating comment %v: %v", c.ID, err)
+		}
+
+		err = m.cp.record(migrationEntry{Kind: migrationProjectComment, ID: c.ID, NewID: created.ID})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *migration) migrateStream(ctx context.Context, streamID string, newProjectID string) error {
+	if newID, ok := m.cp.get(migrationStream, streamID); ok {
+		fmt.Printf("Stream %v was already migrated as %v\n", streamID, newID)
+		return nil
+	}
+
+	archive, err := m.src.Stream.Pull(ctx, streamID)
+	if err != nil {
+		return fmt.Errorf("pulling stream %v: %v", streamID, err)
+	}
+
+	s := archive.Stream
+	err = m.mapAccounts(ctx, "stream "+streamID, s.CanRead, s.CanWrite)
+	if err != nil {
+		return err
+	}
+	for _, data := range archive.Objects {
+		var o struct {
+			ID       string   `json:"_id"`
+			CanRead  []string `json:"canRead"`
+			CanWrite []string `json:"canWrite"`
+		}
+		err = json.Unmarshal(data, &o)
+		if err != nil {
+			return err
+		}
+
+		err = m.mapAccounts(ctx, "object "+o.ID, o.CanRead, o.CanWrite)
+		if err != nil {
+			return err
+		}
+	}
+	for _, c := range archive.Comments {
+		err = m.mapAccounts(ctx, "comment "+c.ID, c.CanRead, c.CanWrite, c.AssignedTo)
+		if err != nil {
+			return err
+		}
+	}
+
+	result, err := m.dst.Stream.Push(ctx, archive, &gospeckle.StreamPushOptions{
+		Created:  m.cp.ids[migrationStreamItem],
+		Accounts: m.cp.ids[migrationAccount],
+		OnCreate: func(id string, newID string) error {
+			return m.cp.record(migrationEntry{Kind: migrationStreamItem, ID: id, NewID: newID})
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("pushing stream %v: %v", streamID, err)
+	}
+
+	// The stream may have been added before the migration was interrupted.
+	project, _, err := m.dst.Project.Get(ctx, newProjectID)
+	if err != nil {
+		return err
+	}
+	if !contains(project.Streams, result.Stream.StreamID) {
+		_, _, err = m.dst.Project.AddStream(ctx, newProjectID, result.Stream.StreamID)
+		if err != nil {
+			return fmt.Errorf("adding stream %v to project %v: %v", result.Stream.StreamID, newProjectID, err)
+		}
+	}
+
+	err = m.cp.record(migrationEntry{
+		Kind:     migrationStream,
+		ID:       streamID,
+		NewID:    result.Stream.StreamID,
+		Objects:  len(result.ObjectIDs),
+		Comments: len(result.CommentIDs),
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Migrated stream %v as %v with %v objects and %v comments\n", streamID, result.Stream.StreamID, len(result.ObjectIDs), len(result.CommentIDs))
+	return nil
+}
+
+// migrateClients copies the clients of the migrated streams.
+func (m *migration) migrateClients(ctx context.Context, streamIDs []string) error {
+	clients, _, err := m.src.APIClient.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range clients {
+		newStreamID, ok := m.cp.get(migrationStream, c.StreamID)
+		if !ok {
+			if contains(streamIDs, c.StreamID) {
+				m.skipped = append(m.skipped, fmt.Sprintf("client %v: stream %v wasn't migrated", c.ID, c.StreamID))
+			}
+			continue
+		}
+		if _, ok := m.cp.get(migrationClient, c.ID); ok {
+			continue
+		}
+
+		err = m.mapAccounts(ctx, "client "+c.ID, c.CanRead, c.CanWrite)
+		if err != nil {
+			return err
+		}
+
+		request := c.Request()
+		request.CanRead = m.remap(c.CanRead)
+		request.CanWrite = m.remap(c.CanWrite)
+		request.StreamID = newStreamID
+
+		created, _, err := m.dst.APIClient.Create(ctx, request)
+		if err != nil {
+			return fmt.Errorf("creating client %v: %v", c.ID, err)
+		}
+
+		err = m.cp.record(migrationEntry{Kind: migrationClient, ID: c.ID, NewID: created.ID})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mapAccounts finds the accounts of the target server with the same email as source
+// accounts, recording the accounts that can't be mapped as dropped from resource.
+func (m *migration) mapAccounts(ctx context.Context, resource string, lists ...[]string) error {
+	for _, ids := range lists {
+		for _, id := range ids {
+			newID, ok := m.cp.get(migrationAccount, id)
+			if !ok {
+				var email string
+				var err error
+				newID, email, err = m.findAccount(ctx, id)
+				if err != nil {
+					return err
+				}
+
+				err = m.cp.record(migrationEntry{Kind: migrationAccount, ID: id, NewID: newID, Email: email})
+				if err != nil {
+					return err
+				}
+			}
+
+			if newID == "" && !contains(m.cp.unmapped[id], resource) {
+				err := m.cp.record(migrationEntry{Kind: migrationUnmapped, ID: id, Resource: resource})
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// findAccount returns the ID of the target account with the email of a source
+// account, or an empty ID if there is none.
+func (m *migration) findAccount(ctx context.Context, id string) (string, string, error) {
+	account, _, err := m.src.Account.Get(ctx, id)
+	if errResp, ok := err.(*gospeckle.ErrorResponse); ok && errResp.Response.StatusCode == http.StatusNotFound {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("looking up account %v: %v", id, err)
+	}
+	if account.Email == "" {
+		return "", "", nil
+	}
+
+	matches, _, err := m.dst.Account.Search(ctx, account.Email)
+	if err != nil {
+		return "", "", fmt.Errorf("searching for %v: %v", account.Email, err)
+	}
+
+	for _, match := range matches {
+		if strings.EqualFold(match.Email, account.Email) {
+			return match.ID, account.Email, nil
+		}
+	}
+	return "", account.Email, nil
+}
+
+// remap maps source account IDs to target accounts, dropping those without one.
+func (m *migration) remap(ids []string) []string {
+	var mapped []string
+	for _, id := range ids {
+		if newID := m.cp.ids[migrationAccount][id]; newID != "" {
+			mapped = append(mapped, newID)
+		}
+	}
+	return mapped
+}
+
+// printReport prints what was migrated and what couldn't be.
+func (m *migration) printReport() {
+	cp := m.cp
+
+	fmt.Printf("Migrated %v streams, %v objects, %v comments, %v project comments and %v clients\n",
+		len(cp.ids[migrationStream]), cp.objects, cp.comments,
+		len(cp.ids[migrationProjectComment]), len(cp.ids[migrationClient]))
+
+	if len(cp.unmapped) > 0 {
+		fmt.Println()
+		fmt.Println("Accounts without a matching email on the target server, dropped from:")
+
+		ids := make([]string, 0, len(cp.unmapped))
+		for id := range cp.unmapped {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ACCOUNT\tEMAIL\tRESOURCES")
+		for _, id := range ids {
+			email := cp.emails[id]
+			if email == "" {
+				email = "(unknown)"
+			}
+			fmt.Fprintf(w, "%v\t%v\t%v\n", id, email, strings.Join(cp.unmapped[id], ", "))
+		}
+		w.Flush()
+	}
+
+	if len(m.skipped) > 0 {
+		fmt.Println()
+		fmt.Println("Not migrated:")
+		for _, s := range m.skipped {
+			fmt.Println(" ", s)
+		}
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
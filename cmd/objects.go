@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	homedir "github.com/mitchellh/go-homedir"
+	gospeckle "github.com/speckleworks/gospeckle/pkg"
+	"github.com/spf13/cobra"
+)
+
+// objectStoreDirEnv overrides the directory of the local object store.
+const objectStoreDirEnv = "GOSPECKLE_OBJECT_STORE_DIR"
+
+var useObjectStore bool
+var objectStoreMaxSize int64
+
+func init() {
+	rootCmd.PersistentFlags().BoolVar(&useObjectStore, "object-store", false, "look objects up in the local object store before fetching them")
+	rootCmd.PersistentFlags().Int64Var(&objectStoreMaxSize, "object-store-max-size", 512, "size in MiB the object store is shrunk to by objects gc")
+
+	rootCmd.AddCommand(objectsCmd)
+	objectsCmd.AddCommand(objectsGCCmd)
+}
+
+// objectStoreDir returns the directory of the local object store.
+func objectStoreDir() (string, error) {
+	if dir := os.Getenv(objectStoreDirEnv); dir != "" {
+		return dir, nil
+	}
+
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".gospeckle", "objects"), nil
+}
+
+// newObjectStore returns the object store used by the client, or nil if
+// --object-store isn't set.
+func newObjectStore() (*gospeckle.ObjectStore, error) {
+	if !useObjectStore {
+		return nil, nil
+	}
+
+	dir, err := objectStoreDir()
+	if err != nil {
+		return nil, err
+	}
+	return gospeckle.NewObjectStore(dir, objectStoreMaxSize*1024*1024), nil
+}
+
+var objectsCmd = &cobra.Command{
+	Use:   "objects",
+	Short: "Manage the local object store",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var objectsGCCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Remove corrupt objects and shrink the object store to --object-store-max-size",
+	Long: `Verifies every object in the local object store against its checksum and removes
+the corrupt ones, then removes the least recently used objects until the store
+fits in --object-store-max-size.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		dir, err := objectStoreDir()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		store := gospeckle.NewObjectStore(dir, objectStoreMaxSize*1024*1024)
+		result, err := store.GC()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Removed %v corrupt and %v unused objects, %v dangling references\n", result.CorruptBlobs, result.EvictedBlobs, result.DanglingRefs)
+		fmt.Printf("Freed %v, %v left in %v\n", formatBytes(result.FreedBytes), formatBytes(result.Size), store.Dir)
+	},
+}
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"os"
+)
+
+// Environment variables overriding the current context, for environments such as CI
+// where writing a config file isn't practical.
+const (
+	contextEnv    = "SPECKLE_CONTEXT"
+	hostEnv       = "SPECKLE_HOST"
+	tokenEnv      = "SPECKLE_TOKEN"
+	apiVersionEnv = "SPECKLE_API_VERSION"
+)
+
+// Sources a resolved setting can come from, from highest to lowest precedence.
+const (
+	sourceFlag   = "flag"
+	sourceEnv    = "env"
+	sourceConfig = "config"
+	sourceUnset  = "unset"
+)
+
+var (
+	serverOverride     string
+	tokenOverride      string
+	apiVersionOverride string
+
+	// resolvedContext and resolveErr are set by the root command before any command runs.
+	resolvedContext ResolvedContext
+	resolveErr      error
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&serverOverride, "server", "", "server url overriding the current context's server host (env "+hostEnv+")")
+	rootCmd.PersistentFlags().StringVar(&tokenOverride, "token", "", "API token overriding the current context's user token (env "+tokenEnv+")")
+	rootCmd.PersistentFlags().StringVar(&apiVersionOverride, "api-version", "", "API version overriding the current context's server version (env "+apiVersionEnv+")")
+}
+
+// ResolvedSetting is a setting of the current context along with where it came from.
+type ResolvedSetting struct {
+	Value  string `yaml:"value"`
+	Source string `yaml:"source"`
+}
+
+// ResolvedContext is the current context once environment variables and flags have
+// been applied.
+type ResolvedContext struct {
+	Context    ResolvedSetting `yaml:"context"`
+	Server     ResolvedSetting `yaml:"server"`
+	Host       ResolvedSetting `yaml:"host"`
+	APIVersion ResolvedSetting `yaml:"api-version"`
+	User       ResolvedSetting `yaml:"user"`
+	Token      ResolvedSetting `yaml:"token"`
+}
+
+// resolveConfigContext returns the current context with its overrides applied. Each
+// setting is taken from its flag, then its environment variable, then the config file.
+// The returned CurrentConfig holds the resolved host, API version and token. An error
+// is returned if the token has to be read from a credential store and can't be.
+func resolveConfigContext() (CurrentConfig, ResolvedContext, error) {
+	var resolved ResolvedContext
+
+	resolved.Context = resolveSetting(contextName, contextEnv, "")
+	if resolved.Context.Source == sourceEnv {
+		contextName = resolved.Context.Value
+	}
+
+	config := getConfigContext()
+	resolved.Context.Value = config.Name
+	if resolved.Context.Source == sourceUnset && config.Name != "" {
+		resolved.Context.Source = sourceConfig
+	}
+
+	resolved.Server = configSetting(config.Server.Name)
+	resolved.User = configSetting(config.User.Name)
+
+	resolved.Host = resolveSetting(serverOverride, hostEnv, config.Server.Host)
+	config.Server.Host = resolved.Host.Value
+
+	resolved.APIVersion = resolveSetting(apiVersionOverride, apiVersionEnv, config.Server.Version)
+	config.Server.Version = resolved.APIVersion.Value
+
+	var err error
+	resolved.Token = resolveSetting(tokenOverride, tokenEnv, "")
+	if resolved.Token.Source == sourceUnset {
+		resolved.Token.Value, err = resolveUserToken(config.User)
+		resolved.Token.Source = sourceConfig
+		if config.User.Credential != nil {
+			resolved.Token.Source = "credential-store " + config.User.Credential.Store
+		}
+		if resolved.Token.Value == "" && err == nil {
+			resolved.Token.Source = sourceUnset
+		}
+	}
+	config.User.Token = resolved.Token.Value
+
+	return config, resolved, err
+}
+
+// resolveSetting returns the value of a flag if it was set, then that of an
+// environment variable, and falls back on the config file's value.
+func resolveSetting(flagValue string, env string, configValue string) ResolvedSetting {
+	if flagValue != "" {
+		return ResolvedSetting{Value: flagValue, Source: sourceFlag}
+	}
+	if v, ok := os.LookupEnv(env); ok && v != "" {
+		return ResolvedSetting{Value: v, Source: sourceEnv}
+	}
+	return configSetting(configValue)
+}
+
+func configSetting(value string) ResolvedSetting {
+	if value == "" {
+		return ResolvedSetting{Source: sourceUnset}
+	}
+	return ResolvedSetting{Value: value, Source: sourceConfig}
+}
+
+// maskToken hides all but the last characters of a token so that it can be printed.
+func maskToken(token string) string {
+	if len(token) <= 8 {
+		if token == "" {
+			return ""
+		}
+		return "****"
+	}
+	return "****" + token[len(token)-4:]
+}
+
+// printResolvedContext prints where each setting of the current context came from.
+func printResolvedContext() error {
+	resolved := resolvedContext
+	resolved.Token.Value = maskToken(resolved.Token.Value)
+
+	err := printYaml(resolved)
+	if err != nil {
+		return err
+	}
+	return resolveErr
+}
@@ -0,0 +1,312 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	gospeckle "github.com/speckleworks/gospeckle/pkg"
+	"github.com/spf13/cobra"
+)
+
+var restoreDir string
+var restoreDryRun bool
+var restoreOnly []string
+
+func init() {
+	restoreCmd.Flags().StringVarP(&restoreDir, "filename", "f", "", "the backup directory to restore")
+	restoreCmd.Flags().BoolVar(&restoreDryRun, "dry-run", false, "verify the backup and print what would be restored without creating anything")
+	restoreCmd.Flags().StringSliceVar(&restoreOnly, "only", nil, "restore only these kinds of resources (projects, streams, clients)")
+	restoreCmd.MarkFlagRequired("filename")
+
+	rootCmd.AddCommand(restoreCmd)
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Recreate the resources of a backup on the current context's server",
+	Long: `Recreates the projects, streams and clients of a backup written by the backup
+command on the current context's server, with the objects of the streams and the
+comments on all of them. Every file is verified against the manifest's checksum
+before anything is created.
+
+Resources are created anew, and references between them, such as the streams of
+a project or the stream of a client, are remapped to the new IDs. References to
+resources that aren't restored, for instance with --only clients, are kept.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		for _, kind := range restoreOnly {
+			if kind != backupProjects && kind != backupStreams && kind != backupClients {
+				fmt.Printf("Unknown kind %v, --only takes projects, streams and clients\n", kind)
+				os.Exit(1)
+			}
+		}
+
+		b, err := readBackup(restoreDir)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		r, err := loadRestore(b)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		if restoreDryRun {
+			r.printPlan()
+			return
+		}
+
+		err = r.restore()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+// restoration holds the verified content of a backup being restored.
+type restoration struct {
+	backup   *backup
+	projects []gospeckle.Project
+	streams  []gospeckle.Stream
+	clients  []gospeckle.APIClient
+	objects  map[string]json.RawMessage
+	// comments are the comments by the resource they are on.
+	comments map[string][]gospeckle.ArchivedComment
+
+	streamIDs map[string]string
+}
+
+// loadRestore reads and verifies the files of the kinds of resources to restore.
+func loadRestore(b *backup) (*restoration, error) {
+	r := &restoration{
+		backup:    b,
+		objects:   map[string]json.RawMessage{},
+		comments:  map[string][]gospeckle.ArchivedComment{},
+		streamIDs: map[string]string{},
+	}
+
+	for _, e := range b.manifest.Entries {
+		if e.Kind != backupComments && e.Kind != backupObjects && !restoring(e.Kind) {
+			continue
+		}
+
+		data, err := b.read(e)
+		if err != nil {
+			return nil, err
+		}
+
+		switch e.Kind {
+		case backupProjects:
+			var p gospeckle.Project
+			err = json.Unmarshal(data, &p)
+			r.projects = append(r.projects, p)
+		case backupStreams:
+			var s gospeckle.Stream
+			err = json.Unmarshal(data, &s)
+			r.streams = append(r.streams, s)
+		case backupClients:
+			var c gospeckle.APIClient
+			err = json.Unmarshal(data, &c)
+			r.clients = append(r.clients, c)
+		case backupObjects:
+			r.objects[e.ID] = data
+		case backupComments:
+			var c gospeckle.ArchivedComment
+			err = json.Unmarshal(data, &c)
+			r.comments[e.Resource] = append(r.comments[e.Resource], c)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", e.Path, err)
+		}
+	}
+
+	return r, nil
+}
+
+// restoring reports whether a kind of resource is restored with the --only flag.
+func restoring(kind string) bool {
+	return len(restoreOnly) == 0 || contains(restoreOnly, kind)
+}
+
+// archive returns a stream of the backup as an archive to push.
+func (r *restoration) archive(s gospeckle.Stream) (*gospeckle.StreamArchive, error) {
+	archive := &gospeckle.StreamArchive{
+		Version:  gospeckle.StreamArchiveVersion,
+		Server:   r.backup.manifest.Server,
+		PulledAt: r.backup.manifest.CreatedAt,
+		Stream:   s,
+		Comments: r.comments[backupStreams+"/"+s.StreamID],
+	}
+
+	added := map[string]bool{}
+	for _, o := range s.Objects {
+		if added[o.ID] {
+			continue
+		}
+		added[o.ID] = true
+
+		data, ok := r.objects[o.ID]
+		if !ok {
+			return nil, fmt.Errorf("stream %v: object %v isn't in the backup", s.StreamID, o.ID)
+		}
+		archive.Objects = append(archive.Objects, data)
+		archive.Comments = append(archive.Comments, r.comments[backupObjects+"/"+o.ID]...)
+	}
+
+	return archive, nil
+}
+
+// printPlan prints what restore would create.
+func (r *restoration) printPlan() {
+	fmt.Printf("Backup of %v from %v, every file matches its checksum\n", r.backup.manifest.Server, r.backup.manifest.CreatedAt)
+
+	for _, s := range r.streams {
+		archive, err := r.archive(s)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		fmt.Printf("Would restore stream %v %q with %v objects and %v comments\n", s.StreamID, s.Name, len(archive.Objects), len(archive.Comments))
+	}
+	for _, p := range r.projects {
+		fmt.Printf("Would restore project %v %q with %v streams and %v comments\n", p.ID, p.Name, len(p.Streams), len(r.comments[backupProjects+"/"+p.ID]))
+	}
+	for _, c := range r.clients {
+		fmt.Printf("Would restore client %v %q of stream %v with %v comments\n", c.ID, c.DocumentName, c.StreamID, len(r.comments[backupClients+"/"+c.ID]))
+	}
+}
+
+func (r *restoration) restore() error {
+	// Objects shared by several streams are only created once.
+	created := map[string]string{}
+
+	for _, s := range r.streams {
+		archive, err := r.archive(s)
+		if err != nil {
+			return err
+		}
+
+		result, err := speckleClient.Stream.Push(ctx, archive, &gospeckle.StreamPushOptions{
+			Created:  created,
+			Accounts: keepAccounts(archive),
+			OnCreate: func(id string, newID string) error {
+				created[id] = newID
+				return nil
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("restoring stream %v: %v", s.StreamID, err)
+		}
+
+		r.streamIDs[s.StreamID] = result.Stream.StreamID
+		fmt.Printf("Restored stream %v as %v\n", s.StreamID, result.Stream.StreamID)
+	}
+
+	for _, p := range r.projects {
+		request := p.Request()
+		request.Streams = r.remapStreams(p.Streams)
+
+		project, _, err := speckleClient.Project.Create(ctx, request)
+		if err != nil {
+			return fmt.Errorf("restoring project %v: %v", p.ID, err)
+		}
+
+		err = restorePermissions(project.ID, p.Permissions)
+		if err != nil {
+			return err
+		}
+
+		for _, c := range r.comments[backupProjects+"/"+p.ID] {
+			_, _, err = speckleClient.CreateArchivedComment(ctx, backupProjects, project.ID, c)
+			if err != nil {
+				return fmt.Errorf("restoring comment %v: %v", c.ID, err)
+			}
+		}
+
+		fmt.Printf("Restored project %v as %v\n", p.ID, project.ID)
+	}
+
+	for _, c := range r.clients {
+		request := c.Request()
+		request.StreamID = r.remapStreams([]string{c.StreamID})[0]
+
+		client, _, err := speckleClient.APIClient.Create(ctx, request)
+		if err != nil {
+			return fmt.Errorf("restoring client %v: %v", c.ID, err)
+		}
+
+		for _, comment := range r.comments[backupClients+"/"+c.ID] {
+			_, _, err = speckleClient.CreateArchivedComment(ctx, backupClients, client.ID, comment)
+			if err != nil {
+				return fmt.Errorf("restoring comment %v: %v", comment.ID, err)
+			}
+		}
+
+		fmt.Printf("Restored client %v as %v\n", c.ID, client.ID)
+	}
+
+	return nil
+}
+
+// remapStreams returns the IDs of the restored streams, keeping those that weren't
+// restored.
+func (r *restoration) remapStreams(ids []string) []string {
+	mapped := make([]string, len(ids))
+	for i, id := range ids {
+		mapped[i] = id
+		if newID, ok := r.streamIDs[id]; ok {
+			mapped[i] = newID
+		}
+	}
+	return mapped
+}
+
+// restorePermissions gives the accounts of a backed up project the same access to
+// the restored one.
+func restorePermissions(projectID string, permissions gospeckle.ProjectPermissions) error {
+	for _, id := range append(append([]string{}, permissions.CanRead...), permissions.CanWrite...) {
+		_, err := speckleClient.Project.AddUser(ctx, projectID, id)
+		if err != nil {
+			return fmt.Errorf("adding %v to project %v: %v", id, projectID, err)
+		}
+	}
+	for _, id := range permissions.CanWrite {
+		_, err := speckleClient.Project.UpgradeUser(ctx, projectID, id)
+		if err != nil {
+			return fmt.Errorf("giving %v write access to project %v: %v", id, projectID, err)
+		}
+	}
+	return nil
+}
+
+// keepAccounts maps every account of an archive to itself, so that a push keeps the
+// permissions of the backup.
+func keepAccounts(archive *gospeckle.StreamArchive) map[string]string {
+	accounts := map[string]string{}
+	add := func(ids ...[]string) {
+		for _, list := range ids {
+			for _, id := range list {
+				accounts[id] = id
+			}
+		}
+	}
+
+	add(archive.Stream.CanRead, archive.Stream.CanWrite)
+	for _, data := range archive.Objects {
+		var o struct {
+			CanRead  []string `json:"canRead"`
+			CanWrite []string `json:"canWrite"`
+		}
+		if json.Unmarshal(data, &o) == nil {
+			add(o.CanRead, o.CanWrite)
+		}
+	}
+	for _, c := range archive.Comments {
+		add(c.CanRead, c.CanWrite, c.AssignedTo)
+	}
+
+	return accounts
+}
@@ -17,7 +17,7 @@ import (
 var cfgFile string
 var contextName string
 var currentConfig CurrentConfig
-var speckleClient gospeckle.Client
+var speckleClient *gospeckle.Client
 var ctx context.Context
 
 // var defaultConfig = map[string]string{"tag": "tags", "category": "categories"}
@@ -41,6 +41,8 @@ func initConfig() {
 	var defaultCfgDir = string(home + "/.gospeckle")
 	var defaultCfgPath = string(defaultCfgDir + "/config.yaml")
 
+	flagCfgFile := cfgFile
+
 	// Don't forget to read config either from cfgFile or from home directory!
 	if cfgFile != "" {
 		// Use config file from the flag.
@@ -68,15 +70,46 @@ func initConfig() {
 			os.Exit(1)
 		}
 	}
+
+	layerPaths = findConfigLayers(defaultCfgPath, flagCfgFile, writableConfigPath())
 }
 
 var rootCmd = &cobra.Command{
 	Use:   "gospeckle",
 	Short: "GoSpeckle is a command line client to interact with speckle servers",
-	Long:  `GoSpeckle is a command line client to interact with speckle servers`,
+	Long: `GoSpeckle is a command line client to interact with speckle servers
+
+The server, API version and token of the current context can be overridden, from
+highest to lowest precedence, by the --context, --server, --api-version and --token
+flags, then by the SPECKLE_CONTEXT, SPECKLE_HOST, SPECKLE_API_VERSION and
+SPECKLE_TOKEN environment variables, then by the config file. Run
+"gospeckle config current-context --resolved" to see where each value comes from.`,
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
 		ctx = context.TODO()
-		currentConfig = getConfigContext()
+		currentConfig, resolvedContext, resolveErr = resolveConfigContext()
+
+		if !isConfigCommand(cmd) && !ignoresCurrentContext(cmd) {
+			config, _, err := getMergedConfig()
+			if err == nil {
+				err = checkCurrentContext(config, resolvedContext)
+			}
+			if err != nil {
+				fmt.Println("The current context can't be used:", err)
+				fmt.Println("Run gospeckle config validate to check the config file.")
+				os.Exit(1)
+			}
+		}
+
+		if resolveErr != nil {
+			// The config commands are how a broken credential gets fixed, so they
+			// still run without a token.
+			if !isConfigCommand(cmd) && !ignoresCurrentContext(cmd) {
+				fmt.Println("Could not read the current context user's credential")
+				fmt.Println(resolveErr)
+				os.Exit(1)
+			}
+		}
+
 		httpClient := new(http.Client)
 		host, err := url.Parse(currentConfig.Server.Host)
 
@@ -86,7 +119,27 @@ var rootCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		speckleClient = *gospeckle.NewClient(httpClient, host, nil, currentConfig.Server.Version, currentConfig.User.Token)
+		speckleClient = gospeckle.NewClient(httpClient, host, nil, currentConfig.Server.Version, currentConfig.User.Token)
+
+		cache, err := newCache()
+		if err != nil {
+			fmt.Println("Could not open the response cache")
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if cache != nil {
+			speckleClient.SetCache(cache)
+		}
+
+		store, err := newObjectStore()
+		if err != nil {
+			fmt.Println("Could not open the object store")
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if store != nil {
+			speckleClient.SetObjectStore(store)
+		}
 
 	},
 	Run: func(cmd *cobra.Command, args []string) {
@@ -95,6 +148,35 @@ var rootCmd = &cobra.Command{
 	},
 }
 
+// isConfigCommand reports whether cmd is the config command or one of its subcommands.
+func isConfigCommand(cmd *cobra.Command) bool {
+	for c := cmd; c != nil; c = c.Parent() {
+		if c == configCmd {
+			return true
+		}
+	}
+	return false
+}
+
+// ignoresCurrentContext reports whether cmd doesn't use the current context, either
+// because it only works on local files, because it takes its contexts as flags, or
+// because it is replaying to the websocket URL given with --url.
+func ignoresCurrentContext(cmd *cobra.Command) bool {
+	if cmd == validateCmd || cmd == infoCmd {
+		return true
+	}
+	if cmd == streamReplayCmd && cmd.Flags().Changed("url") {
+		return true
+	}
+
+	for c := cmd; c != nil; c = c.Parent() {
+		if c == cacheCmd || c == objectsCmd || c == migrateCmd {
+			return true
+		}
+	}
+	return false
+}
+
 // Execute is the entrypoint for the cmd package
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
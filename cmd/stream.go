@@ -1,13 +1,12 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
-	"time"
 
-	"github.com/gorilla/websocket"
 	gospeckle "github.com/speckleworks/gospeckle/pkg"
 	"github.com/spf13/cobra"
 )
@@ -28,23 +27,14 @@ var streamCmd = &cobra.Command{
 	Short: "print the data flowing through a stream",
 	Long:  ``,
 	Run: func(cmd *cobra.Command, args []string) {
-		// Create new client if not specified
-		if clientID == "" {
-			clientRequest := gospeckle.APIClientRequest{
-				StreamID: streamID,
-			}
-			newClient, _, err := speckleClient.APIClient.Create(ctx, clientRequest)
-
-			if err != nil {
-				fmt.Println(err)
-				os.Exit(1)
-			}
-
-			clientID = newClient.ID
-		}
+		session := speckleClient.NewSession(clientID, streamID, &gospeckle.SessionOptions{
+			OnStateChange: logSessionState,
+			Lifecycle:     streamLifecycle(),
+		})
 
-		c, err := speckleClient.NewWebsocket(clientID, streamID)
+		session.OnUnknown(logEvent)
 
+		err := session.Connect(ctx)
 		if err != nil {
 			fmt.Println(err)
 			os.Exit(1)
@@ -53,73 +43,46 @@ var streamCmd = &cobra.Command{
 		interrupt := make(chan os.Signal, 1)
 		signal.Notify(interrupt, os.Interrupt)
 
-		defer c.Close()
-		done := make(chan struct{})
+		select {
+		case <-session.Done():
+		case <-interrupt:
+			fmt.Println("Shutting off stream")
 
-		go func() {
-			defer close(done)
-			for {
-				_, message, err := c.ReadMessage()
-				if err != nil {
-					log.Println("read:", err)
-					return
-				}
-
-				if string(message) == "ping" {
-					err := c.WriteMessage(websocket.TextMessage, []byte("alive"))
-					if err != nil {
-						log.Println(err)
-					}
-					return
-				}
-
-				log.Printf("recv: %s", message)
+			err := session.Close()
+			if err != nil {
+				log.Println("close:", err)
 			}
-		}()
-
-		ticker := time.NewTicker(time.Second)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-done:
-				return
-
-			// ===================================
-			// An example of how to send a message
-			// ===================================
-			// case _ = <-ticker.C:
-
-			// 	message := gospeckle.WebsocketMessage{
-			// 		EventName: "broadcast",
-			// 		StreamID:  streamID,
-			// 		Payload:   "Look at all these chickens!",
-			// 	}
-
-			// 	err := c.WriteJSON(message)
-
-			// 	if err != nil {
-			// 		log.Println("write:", err)
-			// 		return
-			// 	}
+		}
+	},
+}
 
-			case <-interrupt:
-				fmt.Println("Shutting off stream")
+// streamLifecycle returns the lifecycle of the client used by the stream commands.
+// A client created by the CLI because --client_id was omitted is deleted once the
+// command is done.
+func streamLifecycle() *gospeckle.ClientLifecycle {
+	return &gospeckle.ClientLifecycle{
+		DocumentName: "gospeckle",
+		DocumentType: "CLI",
+		Ephemeral:    clientID == "",
+		OnError: func(err error) {
+			log.Println("client:", err)
+		},
+	}
+}
 
-				// Cleanly close the connection by sending a close message and then
-				// waiting (with timeout) for the server to close the connection.
-				err := c.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
-				if err != nil {
-					log.Println("write close:", err)
-					return
-				}
-				select {
-				case <-done:
-				case <-time.After(time.Second):
-				}
-				return
-			}
-		}
+func logSessionState(state gospeckle.SessionState, err error) {
+	if err != nil {
+		log.Printf("%v: %v", state, err)
+		return
+	}
+	log.Println(state)
+}
 
-	},
+func logEvent(ctx context.Context, e gospeckle.Event) {
+	h := e.Header()
+	if h.EventName == "" {
+		log.Printf("recv: %s", h.Raw)
+		return
+	}
+	log.Printf("recv %v: %s", h.EventName, h.Raw)
 }
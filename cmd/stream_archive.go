@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	gospeckle "github.com/speckleworks/gospeckle/pkg"
+	"github.com/spf13/cobra"
+)
+
+var archiveFile string
+
+func init() {
+	streamPullCmd.Flags().StringVarP(&id, "id", "i", "", "the streamId of the stream to pull")
+	streamPullCmd.Flags().StringVarP(&archiveFile, "output", "o", "", "the archive file to write, e.g. stream.speckle")
+	streamPullCmd.MarkFlagRequired("id")
+	streamPullCmd.MarkFlagRequired("output")
+
+	streamPushCmd.Flags().StringVarP(&archiveFile, "filename", "f", "", "the archive file to recreate the stream from")
+	streamPushCmd.MarkFlagRequired("filename")
+
+	streamCmd.AddCommand(streamPullCmd)
+	streamCmd.AddCommand(streamPushCmd)
+}
+
+var streamPullCmd = &cobra.Command{
+	Use:   "pull",
+	Short: "write a stream, its layers, objects and comments to an archive file",
+	Run: func(cmd *cobra.Command, args []string) {
+		archive, err := speckleClient.Stream.Pull(ctx, id)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		// The archive is written next to its destination and renamed, so that a
+		// failed pull doesn't leave a truncated archive behind.
+		tmp := archiveFile + ".tmp"
+		f, err := os.Create(tmp)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		err = archive.Write(f)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Rename(tmp, archiveFile)
+		}
+		if err != nil {
+			os.Remove(tmp)
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Pulled stream %v with %v objects, %v layers and %v comments to %v\n",
+			archive.Stream.StreamID, len(archive.Objects), len(archive.Stream.Layers), len(archive.Comments), archiveFile)
+	},
+}
+
+var streamPushCmd = &cobra.Command{
+	Use:   "push",
+	Short: "recreate a stream pulled to an archive file on the current context's server",
+	Long: `Recreates a stream pulled to an archive file on the current context's server.
+Objects and comments are created anew and references to them are remapped to
+their new IDs. Permissions, parents and children refer to accounts and streams
+of the server the stream was pulled from, so they aren't pushed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		f, err := os.Open(archiveFile)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		defer f.Close()
+
+		info, err := f.Stat()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		archive, err := gospeckle.ReadStreamArchive(f, info.Size())
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		result, err := speckleClient.Stream.Push(ctx, archive, nil)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Pushed stream %v from %v as %v with %v objects and %v comments\n",
+			archive.Stream.StreamID, archive.Server, result.Stream.StreamID, len(result.ObjectIDs), len(result.CommentIDs))
+	},
+}
@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+
+	gospeckle "github.com/speckleworks/gospeckle/pkg"
+	"github.com/spf13/cobra"
+)
+
+// diffValueWidth is the width values are cut to in the text and HTML reports.
+const diffValueWidth = 60
+
+var diffOutput string
+
+func init() {
+	streamDiffCmd.Flags().StringVarP(&diffOutput, "output", "o", "text", "output format of the diff (text|json|html)")
+
+	streamCmd.AddCommand(streamDiffCmd)
+}
+
+var streamDiffCmd = &cobra.Command{
+	Use:   "diff <streamA> <streamB>",
+	Short: "compare the objects and layers of two streams, or two clones of a stream",
+	Long: `Compares the objects and layers of two streams, or two clones of a stream, and
+lists the changes from the first to the second. Objects are matched by application
+ID, then by hash, then by ID, and the properties of modified objects are compared
+one by one. The diff is printed as text, JSON or an HTML report.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if diffOutput != "text" && diffOutput != "json" && diffOutput != "html" {
+			fmt.Printf("Unknown output format %v, use text, json or html\n", diffOutput)
+			os.Exit(1)
+		}
+
+		changes, err := speckleClient.Stream.Compare(ctx, args[0], args[1])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		switch diffOutput {
+		case "json":
+			data, err := json.MarshalIndent(changes, "", "  ")
+			if err == nil {
+				fmt.Println(string(data))
+			}
+		case "html":
+			err = diffReport.Execute(os.Stdout, changes)
+		default:
+			printDiff(changes)
+		}
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+func printDiff(changes *gospeckle.StreamChanges) {
+	counts := map[string]int{}
+	for _, c := range changes.Objects {
+		counts[c.Kind]++
+	}
+	fmt.Printf("Comparing stream %v with stream %v\n", changes.StreamA, changes.StreamB)
+	fmt.Printf("Objects: %v added, %v removed, %v modified, %v unchanged\n",
+		counts[gospeckle.ChangeAdded], counts[gospeckle.ChangeRemoved], counts[gospeckle.ChangeModified], changes.Unchanged)
+
+	for _, c := range changes.Objects {
+		fmt.Println()
+		fmt.Printf("%v %v\n", diffMark(c.Kind), describeObjectChange(c))
+		if c.GeometryChanged {
+			fmt.Printf("    geometry %v -> %v\n", c.GeometryHashA, c.GeometryHashB)
+		}
+		printPropertyChanges(c.Properties)
+	}
+
+	if len(changes.Layers) == 0 {
+		return
+	}
+	fmt.Println()
+	fmt.Println("Layers:")
+	for _, c := range changes.Layers {
+		fmt.Printf("%v layer %q\n", diffMark(c.Kind), c.Name)
+		printPropertyChanges(c.Properties)
+	}
+}
+
+func printPropertyChanges(changes []gospeckle.PropertyChange) {
+	for _, p := range changes {
+		switch p.Kind {
+		case gospeckle.ChangeAdded:
+			fmt.Printf("    + %v: %v\n", p.Path, diffValue(p.B))
+		case gospeckle.ChangeRemoved:
+			fmt.Printf("    - %v: %v\n", p.Path, diffValue(p.A))
+		default:
+			fmt.Printf("    ~ %v: %v -> %v\n", p.Path, diffValue(p.A), diffValue(p.B))
+		}
+	}
+}
+
+// describeObjectChange names the object of a change and its IDs in both streams.
+func describeObjectChange(c gospeckle.ObjectChange) string {
+	description := c.Type
+	if c.Name != "" {
+		description += fmt.Sprintf(" %q", c.Name)
+	}
+	if c.ApplicationID != "" {
+		description += " (" + c.ApplicationID + ")"
+	}
+
+	switch c.Kind {
+	case gospeckle.ChangeAdded:
+		return description + " " + c.B
+	case gospeckle.ChangeRemoved:
+		return description + " " + c.A
+	}
+	return fmt.Sprintf("%v %v -> %v, matched by %v", description, c.A, c.B, c.MatchedBy)
+}
+
+func diffMark(kind string) string {
+	switch kind {
+	case gospeckle.ChangeAdded:
+		return "+"
+	case gospeckle.ChangeRemoved:
+		return "-"
+	}
+	return "~"
+}
+
+// diffValue formats a JSON value of a diff on a single line, cut to diffValueWidth.
+func diffValue(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+
+	value := string(data)
+	if len(value) > diffValueWidth {
+		value = value[:diffValueWidth-3] + "..."
+	}
+	return value
+}
+
+var diffReport = template.Must(template.New("diff").Funcs(template.FuncMap{
+	"mark":     diffMark,
+	"value":    diffValue,
+	"describe": describeObjectChange,
+	"count": func(changes []gospeckle.ObjectChange, kind string) int {
+		n := 0
+		for _, c := range changes {
+			if c.Kind == kind {
+				n++
+			}
+		}
+		return n
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Diff of streams {{.StreamA}} and {{.StreamB}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+td, th { border: 1px solid #ddd; padding: 0.3em 0.6em; text-align: left; font-family: monospace; }
+.added { background: #e6ffed; }
+.removed { background: #ffeef0; }
+.modified { background: #fff5b1; }
+</style>
+</head>
+<body>
+<h1>Stream {{.StreamA}} compared with stream {{.StreamB}}</h1>
+<p>{{count .Objects "added"}} objects added, {{count .Objects "removed"}} removed, {{count .Objects "modified"}} modified and {{.Unchanged}} unchanged.</p>
+{{range .Objects}}
+<h3 class="{{.Kind}}">{{mark .Kind}} {{describe .}}</h3>
+{{if or .GeometryChanged .Properties}}
+<table>
+<tr><th></th><th>Property</th><th>{{$.StreamA}}</th><th>{{$.StreamB}}</th></tr>
+{{if .GeometryChanged}}<tr class="modified"><td>~</td><td>geometryHash</td><td>{{.GeometryHashA}}</td><td>{{.GeometryHashB}}</td></tr>{{end}}
+{{range .Properties}}<tr class="{{.Kind}}"><td>{{mark .Kind}}</td><td>{{.Path}}</td><td>{{if ne .Kind "added"}}{{value .A}}{{end}}</td><td>{{if ne .Kind "removed"}}{{value .B}}{{end}}</td></tr>
+{{end}}
+</table>
+{{end}}
+{{end}}
+{{if .Layers}}
+<h2>Layers</h2>
+<table>
+<tr><th></th><th>Layer</th><th>Changes</th></tr>
+{{range .Layers}}<tr class="{{.Kind}}"><td>{{mark .Kind}}</td><td>{{.Name}}</td><td>{{range .Properties}}{{mark .Kind}} {{.Path}}: {{if ne .Kind "added"}}{{value .A}}{{end}}{{if eq .Kind "modified"}} &rarr; {{end}}{{if ne .Kind "removed"}}{{value .B}}{{end}}<br>{{end}}</td></tr>
+{{end}}
+</table>
+{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	gospeckle "github.com/speckleworks/gospeckle/pkg"
+	"github.com/spf13/cobra"
+)
+
+const streamLogDateFormat = "Mon Jan 2 15:04:05 2006 -0700"
+
+var logGraph bool
+
+func init() {
+	streamLogCmd.Flags().StringVarP(&id, "id", "i", "", "the streamId of the stream to print the history of")
+	streamLogCmd.Flags().BoolVar(&logGraph, "graph", false, "draw the branches of the history next to the log")
+	streamLogCmd.MarkFlagRequired("id")
+
+	streamCmd.AddCommand(streamLogCmd)
+}
+
+var streamLogCmd = &cobra.Command{
+	Use:   "log",
+	Short: "print the history of a stream, made of its clones",
+	Long: `Prints the history of a stream like git log. Every clone of a stream is a
+version of it, so the history holds the stream, the streams it was cloned from and
+the clones made of them, newest first. --graph draws the branches made by cloning
+a stream more than once.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		history, err := speckleClient.Stream.History(ctx, id)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		graph := &historyGraph{}
+		for i, commit := range history {
+			if i > 0 {
+				graph.println("")
+			}
+			if logGraph {
+				graph.add(commit)
+			}
+			printCommit(graph, commit)
+			graph.next(commit)
+		}
+	},
+}
+
+func printCommit(graph *historyGraph, commit gospeckle.StreamCommit) {
+	title := "stream " + commit.StreamID
+	if commit.StreamID == id {
+		title += " (current)"
+	}
+	if commit.Missing {
+		title += " (missing)"
+	}
+	graph.printCommit(title)
+	if commit.Missing {
+		return
+	}
+
+	if commit.Name != "" {
+		graph.println("Name:   " + commit.Name)
+	}
+	if len(commit.Parents) > 1 {
+		graph.println("Merge:  " + strings.Join(commit.Parents, " "))
+	}
+	graph.println("Owner:  " + commit.Owner)
+	if commit.CreatedAt != nil {
+		graph.println("Date:   " + commit.CreatedAt.Local().Format(streamLogDateFormat))
+	}
+
+	message := commit.CommitMessage
+	if message == "" {
+		message = "(no commit message)"
+	}
+	graph.println("")
+	for _, line := range strings.Split(message, "\n") {
+		graph.println("    " + line)
+	}
+}
+
+// historyGraph draws the branches of a history next to its log, like git log
+// --graph. Each column is a line of the history waiting for the commit it names,
+// which is the parent of the last commit printed in it. Without columns, lines
+// are printed as they are.
+type historyGraph struct {
+	columns []string
+	// column is the column of the commit being printed.
+	column int
+	// ends is set when the commit being printed has no parents, so its column ends.
+	ends bool
+}
+
+// add makes room for a commit: the lines waiting for it are joined into one, or a
+// new line is started if none is.
+func (g *historyGraph) add(commit gospeckle.StreamCommit) {
+	g.column = -1
+	for i := 0; i < len(g.columns); i++ {
+		if g.columns[i] != commit.StreamID {
+			continue
+		}
+		if g.column < 0 {
+			g.column = i
+			continue
+		}
+
+		// Another line waits for the commit, it joins the first one.
+		var row strings.Builder
+		for j := 0; j < i; j++ {
+			if j == i-1 {
+				row.WriteString("|/")
+			} else {
+				row.WriteString("| ")
+			}
+		}
+		for j := i + 1; j < len(g.columns); j++ {
+			row.WriteString(" /")
+		}
+		fmt.Println(strings.TrimRight(row.String(), " "))
+
+		g.columns = append(g.columns[:i], g.columns[i+1:]...)
+		i--
+	}
+
+	if g.column < 0 {
+		g.columns = append(g.columns, commit.StreamID)
+		g.column = len(g.columns) - 1
+	}
+	g.ends = len(commit.Parents) == 0
+}
+
+// next moves the commit's line on to its parents, branching it for all but the
+// first one.
+func (g *historyGraph) next(commit gospeckle.StreamCommit) {
+	if len(g.columns) == 0 {
+		return
+	}
+	defer func() { g.column, g.ends = -1, false }()
+
+	if len(commit.Parents) == 0 {
+		g.columns = append(g.columns[:g.column], g.columns[g.column+1:]...)
+		return
+	}
+
+	g.columns[g.column] = commit.Parents[0]
+	for i, parent := range commit.Parents[1:] {
+		var row strings.Builder
+		for j := 0; j < g.column; j++ {
+			row.WriteString("| ")
+		}
+		row.WriteString("|\\")
+		for j := g.column + 1; j < len(g.columns); j++ {
+			row.WriteString(" \\")
+		}
+		fmt.Println(row.String())
+
+		at := g.column + 1 + i
+		g.columns = append(g.columns[:at], append([]string{parent}, g.columns[at:]...)...)
+	}
+}
+
+func (g *historyGraph) printCommit(title string) {
+	fmt.Println(g.prefix("*") + title)
+}
+
+func (g *historyGraph) println(line string) {
+	fmt.Println(strings.TrimRight(g.prefix("|")+line, " "))
+}
+
+// prefix returns the columns to print in front of a line, with mark in the column
+// of the commit.
+func (g *historyGraph) prefix(mark string) string {
+	var prefix strings.Builder
+	for i := range g.columns {
+		switch {
+		case i != g.column:
+			prefix.WriteString("| ")
+		case mark == "|" && g.ends:
+			prefix.WriteString("  ")
+		default:
+			prefix.WriteString(mark + " ")
+		}
+	}
+	return prefix.String()
+}
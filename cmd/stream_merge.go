@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	gospeckle "github.com/speckleworks/gospeckle/pkg"
+	"github.com/spf13/cobra"
+)
+
+var mergeMessage string
+var mergeConflictsFile string
+var mergeForce bool
+
+func init() {
+	streamMergeCmd.Flags().StringVarP(&mergeMessage, "message", "m", "", "the commit message of the merged stream")
+	streamMergeCmd.Flags().StringVar(&mergeConflictsFile, "conflicts", "gospeckle-merge-conflicts.json", "the file to write conflicts to")
+	streamMergeCmd.Flags().BoolVar(&mergeForce, "force", false, "create the merged stream even if there are conflicts")
+
+	streamCmd.AddCommand(streamMergeCmd)
+}
+
+var streamMergeCmd = &cobra.Command{
+	Use:   "merge <streamA> <streamB>",
+	Short: "merge two clones of a stream into a new stream",
+	Long: `Merges two streams cloned from a common ancestor into a new stream whose parents
+are both streams. Objects are matched by application ID, and the objects and
+layers changed on one side only are taken from it. When both sides changed the
+same object or layer differently, the three versions are written to the
+conflicts file to be resolved by hand, and the command exits with status 1
+without creating the merged stream. With --force the merged stream is created
+anyway, keeping the first stream's version of what's in conflict, and the
+command exits with status 0 once it is created, conflicts or not.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		message := mergeMessage
+		if message == "" {
+			message = fmt.Sprintf("Merge %v into %v", args[1], args[0])
+		}
+
+		merge, err := speckleClient.Stream.Merge(ctx, args[0], args[1], message, mergeForce)
+		if err != nil && err != gospeckle.ErrMergeConflicts {
+			fmt.Println(err)
+			if merge != nil && merge.Stream.StreamID != "" {
+				fmt.Printf("The merged stream %v was created\n", merge.Stream.StreamID)
+			}
+			os.Exit(1)
+		}
+
+		created := err == nil
+		if created {
+			fmt.Printf("Merged %v and %v from their common ancestor %v into stream %v, with %v changes from %v and %v from %v\n",
+				merge.A, merge.B, merge.Base, merge.Stream.StreamID, merge.FromA, merge.A, merge.FromB, merge.B)
+		}
+		if len(merge.Conflicts) == 0 {
+			return
+		}
+
+		data, err := json.MarshalIndent(merge, "", "  ")
+		if err == nil {
+			err = ioutil.WriteFile(mergeConflictsFile, data, 0644)
+		}
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		if created {
+			fmt.Printf("%v conflicts kept the version of %v, they are written to %v\n", len(merge.Conflicts), merge.A, mergeConflictsFile)
+			return
+		}
+
+		fmt.Printf("%v and %v have %v conflicts, written to %v. Nothing was created, run with --force to keep the version of %v\n",
+			merge.A, merge.B, len(merge.Conflicts), mergeConflictsFile, merge.A)
+		os.Exit(1)
+	},
+}
@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"os/signal"
+
+	gospeckle "github.com/speckleworks/gospeckle/pkg"
+	"github.com/spf13/cobra"
+)
+
+var recordingFile string
+var replaySpeed float64
+var replayDirection string
+var replayURL string
+
+func init() {
+	streamRecordCmd.Flags().StringVarP(&streamID, "stream_id", "", "", "the ID of the stream to record")
+	streamRecordCmd.Flags().StringVarP(&clientID, "client_id", "", "", "the ID of the client recording the stream")
+	streamRecordCmd.Flags().StringVarP(&recordingFile, "output", "o", "", "the file to write the recorded frames to")
+	streamRecordCmd.MarkFlagRequired("stream_id")
+	streamRecordCmd.MarkFlagRequired("output")
+
+	streamReplayCmd.Flags().StringVarP(&streamID, "stream_id", "", "", "the ID of the stream to replay the recording on")
+	streamReplayCmd.Flags().StringVarP(&clientID, "client_id", "", "", "the ID of the client replaying the recording")
+	streamReplayCmd.Flags().StringVarP(&recordingFile, "filename", "f", "", "the recording to replay")
+	streamReplayCmd.Flags().Float64Var(&replaySpeed, "speed", 1, "replay speed relative to the recording (0 sends everything at once)")
+	streamReplayCmd.Flags().StringVar(&replayDirection, "direction", "in", "which recorded frames to replay (in|out|all)")
+	streamReplayCmd.Flags().StringVar(&replayURL, "url", "", "replay against this websocket URL instead of the current context's server, e.g. a local fake server")
+	streamReplayCmd.MarkFlagRequired("stream_id")
+	streamReplayCmd.MarkFlagRequired("filename")
+
+	streamCmd.AddCommand(streamRecordCmd)
+	streamCmd.AddCommand(streamReplayCmd)
+}
+
+var streamRecordCmd = &cobra.Command{
+	Use:   "record",
+	Short: "record every websocket frame of a stream to a file until interrupted",
+	Run: func(cmd *cobra.Command, args []string) {
+		f, err := os.Create(recordingFile)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		defer f.Close()
+
+		recorder := gospeckle.NewFrameRecorder(f)
+
+		session := speckleClient.NewSession(clientID, streamID, &gospeckle.SessionOptions{
+			OnStateChange: logSessionState,
+			OnFrame:       recorder.Record,
+			Lifecycle:     streamLifecycle(),
+		})
+
+		err = session.Connect(ctx)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+
+		select {
+		case <-session.Done():
+		case <-interrupt:
+			err := session.Close()
+			if err != nil {
+				log.Println("close:", err)
+			}
+		}
+
+		if err := recorder.Err(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+var streamReplayCmd = &cobra.Command{
+	Use:   "replay",
+	Short: "re-emit a recorded websocket session on a stream",
+	Run: func(cmd *cobra.Command, args []string) {
+		f, err := os.Open(recordingFile)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		frames, err := gospeckle.ReadRecording(f)
+		f.Close()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		opts := gospeckle.ReplayOptions{
+			Speed: replaySpeed,
+			OnSend: func(frame gospeckle.RecordedFrame) {
+				log.Printf("sent %v", frame.Message.EventName)
+			},
+		}
+
+		switch replayDirection {
+		case "in":
+			opts.Directions = []gospeckle.FrameDirection{gospeckle.FrameIn}
+		case "out":
+			opts.Directions = []gospeckle.FrameDirection{gospeckle.FrameOut}
+		case "all":
+			opts.Directions = []gospeckle.FrameDirection{gospeckle.FrameIn, gospeckle.FrameOut}
+		default:
+			fmt.Printf("unknown direction: %v\n", replayDirection)
+			os.Exit(1)
+		}
+
+		// Fake servers usually only speak websockets, so the client lifecycle,
+		// which goes through the REST API, is only managed against real servers.
+		client := speckleClient
+		sessionOpts := &gospeckle.SessionOptions{Lifecycle: streamLifecycle()}
+		if replayURL != "" {
+			wsURL, err := url.Parse(replayURL)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			client = gospeckle.NewClient(nil, speckleClient.APIURL, wsURL, "", speckleClient.Token)
+			sessionOpts = nil
+		}
+
+		session := client.NewSession(clientID, streamID, sessionOpts)
+
+		err = session.Connect(ctx)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		// os.Exit skips deferred calls, so the session is closed explicitly.
+		err = gospeckle.Replay(ctx, session, frames, opts)
+		session.Close()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var revertTo string
+var revertMessage string
+
+func init() {
+	streamRevertCmd.Flags().StringVarP(&id, "id", "i", "", "the streamId of the stream to revert")
+	streamRevertCmd.Flags().StringVar(&revertTo, "to", "", "the streamId of the clone to restore the objects and layers of")
+	streamRevertCmd.Flags().StringVarP(&revertMessage, "message", "m", "", "the commit message of the clone keeping the stream's state before the revert")
+	streamRevertCmd.MarkFlagRequired("id")
+	streamRevertCmd.MarkFlagRequired("to")
+
+	streamCmd.AddCommand(streamRevertCmd)
+}
+
+var streamRevertCmd = &cobra.Command{
+	Use:   "revert",
+	Short: "restore the objects and layers of a stream from a clone in its history",
+	Long: `Restores the objects and layers of a stream from a clone in its history, as
+listed by stream log. The stream is cloned before it is reverted, so that its
+state before the revert stays in its history.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		message := revertMessage
+		if message == "" {
+			message = "Before reverting to " + revertTo
+		}
+
+		result, err := speckleClient.Stream.Revert(ctx, id, revertTo, message)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Reverted stream %v to %v, its previous state is kept in %v\n", result.StreamID, revertTo, result.CloneID)
+	},
+}
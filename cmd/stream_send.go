@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	gospeckle "github.com/speckleworks/gospeckle/pkg"
+	"github.com/spf13/cobra"
+)
+
+var eventName string
+var payload string
+var interactive bool
+
+func init() {
+	streamSendCmd.Flags().StringVarP(&streamID, "stream_id", "", "", "the ID of the stream to send messages to")
+	streamSendCmd.Flags().StringVarP(&clientID, "client_id", "", "", "the ID of the client sending the messages")
+	streamSendCmd.Flags().StringVar(&eventName, "event", gospeckle.EventBroadcast, "the event name of the message")
+	streamSendCmd.Flags().StringVar(&payload, "payload", "", "the message payload, as JSON or text (prefix with @ to read it from a file)")
+	streamSendCmd.Flags().BoolVar(&interactive, "interactive", false, "send every JSON line read from stdin as a message and print the messages received")
+	streamSendCmd.MarkFlagRequired("stream_id")
+
+	streamCmd.AddCommand(streamSendCmd)
+}
+
+var streamSendCmd = &cobra.Command{
+	Use:   "send",
+	Short: "send messages to the clients of a stream",
+	Long: `send messages to the clients of a stream.
+
+Without --interactive a single message built from --event and --payload is sent.
+With --interactive each line read from stdin is sent as a message, e.g.
+
+  {"eventName": "broadcast", "payload": {"eventType": "update-global"}}
+
+where eventName defaults to --event and streamId to --stream_id.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		opts := &gospeckle.SessionOptions{Lifecycle: streamLifecycle()}
+		if interactive {
+			opts.OnStateChange = logSessionState
+		}
+
+		var message gospeckle.WebsocketMessage
+		if !interactive {
+			var err error
+			message, err = newMessage(eventName, payload)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		}
+
+		session := speckleClient.NewSession(clientID, streamID, opts)
+		if interactive {
+			session.OnUnknown(logEvent)
+		}
+
+		err := session.Connect(ctx)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		// os.Exit skips deferred calls, so the session is closed explicitly.
+		if !interactive {
+			err = session.Send(message)
+			session.Close()
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		scanner := bufio.NewScanner(os.Stdin)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+
+			message := gospeckle.WebsocketMessage{EventName: eventName}
+			err := json.Unmarshal([]byte(line), &message)
+			if err != nil {
+				log.Println("invalid message:", err)
+				continue
+			}
+
+			err = session.Send(message)
+			if err != nil {
+				log.Println("send:", err)
+				continue
+			}
+			log.Printf("sent %v", message.EventName)
+		}
+
+		session.Close()
+
+		if err := scanner.Err(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+// newMessage builds a message from an event name and a payload flag. A payload starting
+// with @ is read from a file; payloads that aren't valid JSON are sent as strings.
+func newMessage(event string, payload string) (gospeckle.WebsocketMessage, error) {
+	message := gospeckle.WebsocketMessage{EventName: event}
+
+	data := []byte(payload)
+	if strings.HasPrefix(payload, "@") {
+		var err error
+		data, err = ioutil.ReadFile(payload[1:])
+		if err != nil {
+			return message, err
+		}
+	}
+
+	if len(data) == 0 {
+		return message, nil
+	}
+
+	if json.Valid(data) {
+		message.Payload = json.RawMessage(data)
+	} else {
+		message.Payload = string(data)
+	}
+
+	return message, nil
+}
@@ -2,13 +2,14 @@ package cmd
 
 import (
 	"bytes"
-	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 
 	"github.com/mitchellh/mapstructure"
 	gospeckle "github.com/speckleworks/gospeckle/pkg"
@@ -25,7 +26,15 @@ type ConfigContext struct {
 type ConfigUser struct {
 	Name  string `yaml:"name"`
 	Email string `yaml:"email"`
-	Token string `yaml:"token"`
+	Token string `yaml:"token,omitempty"`
+	// Credential references the token in a credential store, in which case Token is empty.
+	Credential *CredentialRef `yaml:"credential,omitempty"`
+}
+
+// CredentialRef is where a user's token is kept in a credential store.
+type CredentialRef struct {
+	Store string `yaml:"store"`
+	Key   string `yaml:"key"`
 }
 
 type ConfigServer struct {
@@ -41,7 +50,12 @@ type CurrentConfig struct {
 }
 
 type Config struct {
-	CurrentContext string          `yaml:"current-context" mapstructure:"current-context"`
+	CurrentContext string `yaml:"current-context" mapstructure:"current-context"`
+	// CredentialStore is where login and register save tokens: file, helper:<command>,
+	// or empty to keep them in this file.
+	CredentialStore string `yaml:"credential-store,omitempty" mapstructure:"credential-store"`
+	// CredentialFile overrides the path of the encrypted credential file.
+	CredentialFile string          `yaml:"credential-file,omitempty" mapstructure:"credential-file"`
 	Servers        []ConfigServer  `yaml:"servers"`
 	Users          []ConfigUser    `yaml:"users"`
 	Contexts       []ConfigContext `yaml:"contexts"`
@@ -49,6 +63,7 @@ type Config struct {
 
 type FileInput struct {
 	Type     string                    `json:"type" yaml:"type"`
+	ID       string                    `json:"id,omitempty" yaml:"id,omitempty"`
 	Metadata gospeckle.RequestMetadata `json:"metadata" yaml:"metadata"`
 	Spec     interface{}               `json:"spec" yaml:"spec"`
 }
@@ -58,54 +73,30 @@ type Decoder interface {
 }
 
 type RequestObjects struct {
-	Projects []gospeckle.ProjectRequest
-	Streams  []gospeckle.StreamRequest
-	Clients  []gospeckle.APIClientRequest
+	Projects []ProjectInput
+	Streams  []StreamInput
+	Clients  []ClientInput
 }
 
-func (r RequestObjects) MakeRequests(ctx context.Context, c *gospeckle.Client) {
-	var totalObjects []interface{}
-
-	totalObjects = append(totalObjects, r.Projects, r.Streams, r.Clients)
-	//  len(r.Projects) + len(r.Streams) + len(r.Clients)
-	ch := make(chan string)
-
-	for _, item := range r.Projects {
-		go func(item gospeckle.ProjectRequest) {
-			p, _, err := c.Project.Create(ctx, item)
-			if err != nil {
-				ch <- err.Error()
-			} else {
-				ch <- "Created project " + p.Name + " with ID: " + p.ID
-			}
-		}(item)
-	}
-
-	for _, item := range r.Streams {
-		go func(item gospeckle.StreamRequest) {
-			s, _, err := c.Stream.Create(ctx, item)
-			if err != nil {
-				ch <- err.Error()
-			} else {
-				ch <- "Created stream " + s.Name + " with ID: " + s.StreamID
-			}
-		}(item)
-	}
+// ProjectInput is a project read from a resource file. If ID is set the existing
+// project is updated instead of a new one being created.
+type ProjectInput struct {
+	ID string
+	gospeckle.ProjectRequest
+}
 
-	for _, item := range r.Clients {
-		go func(item gospeckle.APIClientRequest) {
-			p, _, err := c.APIClient.Create(ctx, item)
-			if err != nil {
-				ch <- err.Error()
-			} else {
-				ch <- "Created client " + p.DocumentName + " with ID: " + p.ID
-			}
-		}(item)
-	}
+// StreamInput is a stream read from a resource file. If ID is set the existing
+// stream is updated instead of a new one being created.
+type StreamInput struct {
+	ID string
+	gospeckle.StreamRequest
+}
 
-	for range totalObjects {
-		fmt.Println(<-ch)
-	}
+// ClientInput is an api client read from a resource file. If ID is set the existing
+// client is updated instead of a new one being created.
+type ClientInput struct {
+	ID string
+	gospeckle.APIClientRequest
 }
 
 func printLogo() {
@@ -195,11 +186,26 @@ func (c Config) getContextByName(name string) (*ConfigContext, error) {
 	return &c.Contexts[sliceIndex], nil
 }
 
+// userServer returns the server of the first context using a user, which is the
+// server the user's token was most likely issued by.
+func (c Config) userServer(name string) ConfigServer {
+	for _, ctx := range c.Contexts {
+		if ctx.User != name {
+			continue
+		}
+		s, err := c.getServerByName(ctx.Server)
+		if err == nil {
+			return *s
+		}
+	}
+	return ConfigServer{}
+}
+
 var defaultConfig = []byte(`
 current-context: default
 servers:
-	- name: hestia
-		host: https://hestia.speckle.works
+  - name: hestia
+    host: https://hestia.speckle.works
     version: v1
 users:
   - name: anonymous
@@ -230,6 +236,8 @@ func writeDefaultConfig(cfgDir string, cfgFile string) error {
 	return nil
 }
 
+// getConfig returns the config file that config commands write to. Use
+// getMergedConfig to read the config all layers add up to.
 func getConfig() (Config, error) {
 	var c Config
 
@@ -240,20 +248,18 @@ func getConfig() (Config, error) {
 
 func getConfigContext() CurrentConfig {
 	var config CurrentConfig
-	var contexts []ConfigContext
-	var users []ConfigUser
-	var servers []ConfigServer
+
+	merged := mustGetMergedConfig()
+	contexts := merged.Contexts
+	users := merged.Users
+	servers := merged.Servers
 
 	if contextName == "" {
-		contextName = viper.GetString("current-context")
+		contextName = merged.CurrentContext
 	}
 
 	config.Name = contextName
 
-	viper.UnmarshalKey("contexts", &contexts)
-	viper.UnmarshalKey("users", &users)
-	viper.UnmarshalKey("servers", &servers)
-
 	for _, c := range contexts {
 		if c.Name == contextName {
 			for _, s := range servers {
@@ -273,80 +279,320 @@ func getConfigContext() CurrentConfig {
 	return config
 }
 
-func parseResourceFile(filePath string) (RequestObjects, error) {
+// resourceFileExtensions are the extensions picked up when a directory is
+// passed as a resource file path.
+var resourceFileExtensions = map[string]bool{
+	".yaml": true,
+	".yml":  true,
+	".json": true,
+}
+
+// parseResourceFiles reads the speckle resources from every path given. Each path
+// can be "-" for stdin, a file, a directory (walked recursively if recursive is set)
+// or a glob pattern.
+func parseResourceFiles(paths []string, recursive bool) (RequestObjects, error) {
 	var r RequestObjects
 
-	data, err := os.Open(filePath)
+	files, err := expandResourcePaths(paths, recursive)
 	if err != nil {
 		return r, err
 	}
 
-	fileType := filepath.Ext(filePath)
-
-	switch fileType {
-	case ".yaml":
-		d := yaml.NewDecoder(data)
-		err := streamDecode(d, &r)
+	for _, f := range files {
+		objects, err := parseResourceFile(f)
 		if err != nil {
-			return r, err
+			return r, fmt.Errorf("%v: %v", f, err)
 		}
-	case ".yml":
-		d := yaml.NewDecoder(data)
-		err := streamDecode(d, &r)
-		if err != nil {
-			return r, err
+
+		r.Projects = append(r.Projects, objects.Projects...)
+		r.Streams = append(r.Streams, objects.Streams...)
+		r.Clients = append(r.Clients, objects.Clients...)
+	}
+
+	return r, nil
+}
+
+// expandResourcePaths resolves directories and glob patterns into the list of
+// files to read resources from.
+func expandResourcePaths(paths []string, recursive bool) ([]string, error) {
+	var files []string
+	seen := map[string]bool{}
+
+	add := func(f string) {
+		if !seen[f] {
+			seen[f] = true
+			files = append(files, f)
+		}
+	}
+
+	for _, p := range paths {
+		if p == "-" {
+			if seen[p] {
+				return nil, fmt.Errorf("stdin can only be read from once")
+			}
+			add(p)
+			continue
 		}
 
-	case ".json":
-		d := json.NewDecoder(data)
-		err := streamDecode(d, &r)
+		matches := []string{p}
+		if _, err := os.Stat(p); os.IsNotExist(err) {
+			matches, err = filepath.Glob(p)
+			if err != nil {
+				return nil, err
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no files found matching %v", p)
+			}
+		}
+
+		for _, m := range matches {
+			info, err := os.Stat(m)
+			if err != nil {
+				return nil, err
+			}
+
+			if !info.IsDir() {
+				add(m)
+				continue
+			}
+
+			dirFiles, err := listResourceDir(m, recursive)
+			if err != nil {
+				return nil, err
+			}
+			for _, f := range dirFiles {
+				add(f)
+			}
+		}
+	}
+
+	return files, nil
+}
+
+// listResourceDir lists the resource files held in a directory.
+func listResourceDir(dir string, recursive bool) ([]string, error) {
+	var files []string
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
-			return r, err
+			return err
+		}
+
+		if info.IsDir() {
+			if path != dir && !recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if resourceFileExtensions[filepath.Ext(path)] {
+			files = append(files, path)
 		}
+		return nil
+	})
+
+	return files, err
+}
+
+func parseResourceFile(filePath string) (RequestObjects, error) {
+	var r RequestObjects
+	var data []byte
+	var err error
+
+	if filePath == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(filePath)
+	}
+	if err != nil {
+		return r, err
+	}
+
+	var d Decoder
+
+	switch resourceFileType(filePath, data) {
+	case "json":
+		d = json.NewDecoder(bytes.NewReader(data))
+	default:
+		d = yaml.NewDecoder(bytes.NewReader(data))
+	}
+
+	err = streamDecode(d, &r)
+	if err != nil {
+		return r, err
 	}
 
 	return r, nil
 }
 
+// resourceFileType returns the format of a resource file based on its extension.
+// The content is sniffed when the extension isn't recognised (or for stdin).
+func resourceFileType(filePath string, data []byte) string {
+	switch filepath.Ext(filePath) {
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".json":
+		return "json"
+	}
+
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		return "json"
+	}
+
+	return "yaml"
+}
+
+// decodeSpec decodes the spec of a resource file into a request payload. Keys are
+// matched against the payload's json tags so specs use the same field names as the
+// Speckle API. The Go field names read by earlier versions, such as commitMessage,
+// are still accepted. Unknown keys are an error rather than silently ignored.
+func decodeSpec(spec interface{}, result interface{}) error {
+	var metadata mapstructure.Metadata
+	d, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		TagName:  "json",
+		Result:   result,
+		Metadata: &metadata,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = d.Decode(specFieldNames(spec, result))
+	if err != nil {
+		return err
+	}
+
+	// Only the spec's own keys are checked: nested objects, such as a stream's
+	// objects, may hold any property.
+	for _, key := range metadata.Unused {
+		if strings.ContainsAny(key, ".[") {
+			continue
+		}
+		for _, k := range requestMetadataKeys {
+			if key == k {
+				return fmt.Errorf("unknown spec field %q, it belongs under metadata", key)
+			}
+		}
+		return fmt.Errorf("unknown spec field %q", key)
+	}
+
+	return nil
+}
+
+// specFieldNames renames the keys of a spec that match a Go field name of the
+// request payload, rather than its json tag, to the json tag.
+func specFieldNames(spec interface{}, result interface{}) interface{} {
+	keys := map[string]string{}
+	t := reflect.TypeOf(result).Elem()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			keys[strings.ToLower(f.Name)] = name
+		}
+	}
+
+	v := reflect.ValueOf(spec)
+	if v.Kind() != reflect.Map {
+		return spec
+	}
+
+	renamed := map[string]interface{}{}
+	for _, k := range v.MapKeys() {
+		key := fmt.Sprint(k.Interface())
+		if name, ok := keys[strings.ToLower(key)]; ok && v.MapIndex(reflect.ValueOf(name)).Kind() == reflect.Invalid {
+			key = name
+		}
+		renamed[key] = v.MapIndex(k).Interface()
+	}
+	return renamed
+}
+
+// fileInputs is a document of a resource file, which holds either a single resource
+// or a list of them.
+type fileInputs []FileInput
+
+func (f *fileInputs) UnmarshalJSON(data []byte) error {
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		return json.Unmarshal(data, (*[]FileInput)(f))
+	}
+
+	var i FileInput
+	err := json.Unmarshal(data, &i)
+	*f = fileInputs{i}
+	return err
+}
+
+func (f *fileInputs) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal((*[]FileInput)(f)); err == nil {
+		return nil
+	}
+
+	var i FileInput
+	err := unmarshal(&i)
+	*f = fileInputs{i}
+	return err
+}
+
 func streamDecode(d Decoder, r *RequestObjects) error {
 
 	for {
-		var i FileInput
-		if err := d.Decode(&i); err == io.EOF {
+		var inputs fileInputs
+		if err := d.Decode(&inputs); err == io.EOF {
 			break
 		} else if err != nil {
-			log.Fatal(err)
+			return err
 		}
-		// fmt.Println(i)
 
-		switch i.Type {
-		case "project":
-			var p gospeckle.ProjectRequest
-			err := mapstructure.Decode(i.Spec, &p)
-			p.RequestMetadata = i.Metadata
-			if err != nil {
+		for _, i := range inputs {
+			if err := addFileInput(i, r); err != nil {
 				return err
 			}
-			r.Projects = append(r.Projects, p)
+		}
+	}
+	return nil
+}
 
-		case "stream":
-			var s gospeckle.StreamRequest
-			err := mapstructure.Decode(i.Spec, &s)
-			s.RequestMetadata = i.Metadata
-			if err != nil {
-				return err
-			}
-			r.Streams = append(r.Streams, s)
+// addFileInput decodes the spec of a resource and adds it to the resources to apply.
+func addFileInput(i FileInput, r *RequestObjects) error {
+	switch i.Type {
+	case "project":
+		var p gospeckle.ProjectRequest
+		err := decodeSpec(i.Spec, &p)
+		p.RequestMetadata = i.Metadata
+		if err != nil {
+			return err
+		}
+		r.Projects = append(r.Projects, ProjectInput{ID: i.ID, ProjectRequest: p})
 
-		case "client":
-			var c gospeckle.APIClientRequest
-			err := mapstructure.Decode(i.Spec, &c)
-			c.RequestMetadata = i.Metadata
-			if err != nil {
-				return err
-			}
-			r.Clients = append(r.Clients, c)
+	case "stream":
+		var s gospeckle.StreamRequest
+		err := decodeSpec(i.Spec, &s)
+		s.RequestMetadata = i.Metadata
+		if err != nil {
+			return err
 		}
+		r.Streams = append(r.Streams, StreamInput{ID: i.ID, StreamRequest: s})
+
+	case "client":
+		var c gospeckle.APIClientRequest
+		err := decodeSpec(i.Spec, &c)
+		c.RequestMetadata = i.Metadata
+		if err != nil {
+			return err
+		}
+		r.Clients = append(r.Clients, ClientInput{ID: i.ID, APIClientRequest: c})
+
+	case "":
+		// Empty documents, e.g. a trailing "---", carry nothing to apply.
+		if i.Spec != nil {
+			return fmt.Errorf("resource is missing a type")
+		}
+
+	default:
+		return fmt.Errorf("unknown resource type: %v", i.Type)
 	}
 	return nil
 }
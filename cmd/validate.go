@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+
+	validateCmd.Flags().StringArrayVarP(&filenames, "filename", "f", nil, "file, directory or glob to read speckle resources from (\"-\" reads stdin, can be repeated)")
+	validateCmd.Flags().BoolVarP(&recursive, "recursive", "R", false, "process the directories passed to --filename recursively")
+	validateCmd.MarkFlagRequired("filename")
+}
+
+// validateCmd represents the validate command
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "check that resource files can be applied without sending anything to a speckle server",
+	Run: func(cmd *cobra.Command, args []string) {
+		requestObjects, err := parseResourceFiles(filenames, recursive)
+
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Resources are valid: %d project(s), %d stream(s), %d client(s)\n",
+			len(requestObjects.Projects), len(requestObjects.Streams), len(requestObjects.Clients))
+	},
+}
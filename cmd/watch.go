@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+
+	gospeckle "github.com/speckleworks/gospeckle/pkg"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+
+	watchStreamCmd.Flags().StringVarP(&id, "id", "i", "", "the ID of the stream to watch")
+	watchStreamCmd.MarkFlagRequired("id")
+	watchCmd.AddCommand(watchStreamCmd)
+}
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Watch speckle resources for changes",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var watchStreamCmd = &cobra.Command{
+	Use:   "stream",
+	Short: "Print the objects and layers added, removed or modified each time a stream is updated",
+	Run: func(cmd *cobra.Command, args []string) {
+		watchCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		go func() {
+			<-interrupt
+			cancel()
+		}()
+
+		changes, err := speckleClient.Stream.Watch(watchCtx, id)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Watching stream %v\n", id)
+
+		for change := range changes {
+			printStreamChange(change)
+		}
+	},
+}
+
+func printStreamChange(change gospeckle.StreamChange) {
+	if change.Err != nil {
+		fmt.Println("error:", change.Err)
+		return
+	}
+
+	fmt.Printf("stream %v updated\n", change.Stream.StreamID)
+
+	for _, o := range change.AddedObjects {
+		fmt.Printf("  + object %v (%v)\n", o.ID, o.Type)
+	}
+	for _, o := range change.ModifiedObjects {
+		fmt.Printf("  ~ object %v (%v)\n", o.ID, o.Type)
+	}
+	for _, o := range change.RemovedObjects {
+		fmt.Printf("  - object %v (%v)\n", o.ID, o.Type)
+	}
+	for _, l := range change.AddedLayers {
+		fmt.Printf("  + layer %v\n", l.Name)
+	}
+	for _, l := range change.ModifiedLayers {
+		fmt.Printf("  ~ layer %v\n", l.Name)
+	}
+	for _, l := range change.RemovedLayers {
+		fmt.Printf("  - layer %v\n", l.Name)
+	}
+}
@@ -29,7 +29,24 @@ type APIClientRequest struct {
 	DocumentLocation string `json:"documentLocation,omitempty"`
 	DocumentGUID     string `json:"documentGuid,omitempty"`
 	StreamID         string `json:"streamId,omitempty"`
-	Online           bool   `json:"online,omitempty"`
+	// Online is a pointer so that a client can be marked offline in an update.
+	Online *bool `json:"online,omitempty"`
+}
+
+// Request returns an APIClientRequest that recreates the apiClient's current state.
+func (c APIClient) Request() APIClientRequest {
+	online := c.Online
+
+	return APIClientRequest{
+		RequestMetadata:  c.Metadata.Request(),
+		Role:             c.Role,
+		DocumentName:     c.DocumentName,
+		DocumentType:     c.DocumentType,
+		DocumentLocation: c.DocumentLocation,
+		DocumentGUID:     c.DocumentGUID,
+		StreamID:         c.StreamID,
+		Online:           &online,
+	}
 }
 
 // APIClientService is the service that communicates with the APIClients API
@@ -103,6 +120,22 @@ func (s *APIClientService) Update(ctx context.Context, id string, update APIClie
 	return resp, nil
 }
 
+// Restore puts an api client back in a state returned by Get earlier. Unlike Update, the fields
+// that were empty are sent too, so that they are cleared.
+func (s *APIClientService) Restore(ctx context.Context, id string, prior APIClient) (*http.Response, error) {
+	req, err := s.client.NewRequest(ctx, http.MethodPut, apiClientBasePath+"/"+id, restoreFields(prior.Request()))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, _, err := s.client.Do(ctx, req, nil, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
 // Delete deletes a specific apiClient indexed by it's ID
 func (s *APIClientService) Delete(ctx context.Context, id string) (*http.Response, error) {
 	req, err := s.client.NewRequest(ctx, http.MethodDelete, apiClientBasePath+"/"+id, nil)
@@ -134,3 +167,20 @@ func (s *APIClientService) CreateComment(ctx context.Context, id string, new Com
 
 	return resource, resp, nil
 }
+
+// GetComments will get comments for a specific APIClient indexed by ID.
+func (s *APIClientService) GetComments(ctx context.Context, id string) ([]Comment, *http.Response, error) {
+	resource := new([]Comment)
+
+	req, err := s.client.NewRequest(ctx, http.MethodGet, "comments/"+apiClientBasePath+"/"+id, nil)
+	if err != nil {
+		return *resource, nil, err
+	}
+
+	resp, _, err := s.client.Do(ctx, req, resource, true)
+	if err != nil {
+		return *resource, nil, err
+	}
+
+	return *resource, resp, nil
+}
@@ -0,0 +1,641 @@
+package gospeckle
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// StreamArchiveVersion is the version of the archive layout written by
+// StreamArchive.Write.
+const StreamArchiveVersion = 1
+
+// archiveBulkSize is the number of objects requested at once when pulling a stream.
+const archiveBulkSize = 500
+
+// Entries of a stream archive.
+const (
+	archiveManifestEntry = "archive.json"
+	archiveStreamEntry   = "stream.json"
+	archiveLayersEntry   = "layers.json"
+	archiveCommentsEntry = "comments.json"
+	archiveObjectsDir    = "objects/"
+)
+
+// objectServerFields are the fields of an object set by the server that created it,
+// which a push leaves for the receiving server to set.
+var objectServerFields = []string{"_id", "owner", "canRead", "canWrite", "comments", "createdAt", "updatedAt", "__v"}
+
+// objectReferenceFields are the fields of an object that hold the IDs of other objects.
+var objectReferenceFields = []string{"children", "parent", "partOf", "ancestors"}
+
+// StreamArchive is a portable copy of a stream: its metadata, layers, objects and
+// comments. Objects are kept as the JSON the server sent, so that fields Object
+// doesn't declare survive the trip.
+type StreamArchive struct {
+	Version  int       `json:"version"`
+	Server   string    `json:"server"`
+	PulledAt time.Time `json:"pulledAt"`
+	// Stream holds the stream's metadata and layers, and placeholders for its objects.
+	Stream   Stream            `json:"-"`
+	Objects  []json.RawMessage `json:"-"`
+	Comments []ArchivedComment `json:"-"`
+}
+
+// ArchivedComment is a comment as the server sends it, its metadata alongside its
+// other fields. Comment holds its metadata in a field of its own, which the server's
+// responses don't fill, so archives, backups and migrations use ArchivedComment to
+// keep a comment's ID, owner and permissions.
+type ArchivedComment struct {
+	Metadata
+	commentFields
+}
+
+// commentFields are the fields of a comment besides its metadata.
+type commentFields struct {
+	Resource       CommentResource `json:"resource,omitempty"`
+	Flagged        bool            `json:"flagged,omitempty"`
+	Closed         bool            `json:"closed,omitempty"`
+	AssignedTo     []string        `json:"assignedTo,omitempty"`
+	Labels         []string        `json:"labels,omitempty"`
+	Text           string          `json:"text,omitempty"`
+	OtherResources []string        `json:"otherResources,omitempty"`
+	View           View            `json:"view,omitempty"`
+	Screenshot     string          `json:"screenshot,omitempty"`
+}
+
+// archivedCommentRequest is the payload recreating an archived comment, with its
+// permissions alongside its other fields where the server reads them.
+type archivedCommentRequest struct {
+	RequestMetadata
+	commentFields
+}
+
+// Comment returns the archived comment as a Comment.
+func (c ArchivedComment) Comment() Comment {
+	return Comment{
+		Metadata:       c.Metadata,
+		Resource:       c.Resource,
+		Flagged:        c.Flagged,
+		Closed:         c.Closed,
+		AssignedTo:     c.AssignedTo,
+		Labels:         c.Labels,
+		Text:           c.Text,
+		OtherResources: c.OtherResources,
+		View:           c.View,
+		Screenshot:     c.Screenshot,
+	}
+}
+
+// ListArchivedComments returns the comments on a resource as ArchivedComment.
+// resourceType is the resource's collection: projects, streams, clients or objects.
+func (c *Client) ListArchivedComments(ctx context.Context, resourceType string, id string) ([]ArchivedComment, *http.Response, error) {
+	resource := []ArchivedComment{}
+
+	req, err := c.NewRequest(ctx, http.MethodGet, commentBasePath+"/"+resourceType+"/"+id, nil)
+	if err != nil {
+		return resource, nil, err
+	}
+
+	resp, _, err := c.Do(ctx, req, &resource, true)
+	if err != nil {
+		return resource, nil, err
+	}
+
+	return resource, resp, nil
+}
+
+// CreateArchivedComment recreates an archived comment on a resource, with its
+// permissions and assignees, and returns the created comment. resourceType is as for
+// ListArchivedComments.
+func (c *Client) CreateArchivedComment(ctx context.Context, resourceType string, id string, comment ArchivedComment) (ArchivedComment, *http.Response, error) {
+	resource := ArchivedComment{}
+
+	request := archivedCommentRequest{
+		RequestMetadata: comment.Metadata.Request(),
+		commentFields:   comment.commentFields,
+	}
+
+	req, err := c.NewRequest(ctx, http.MethodPost, commentBasePath+"/"+resourceType+"/"+id, request)
+	if err != nil {
+		return resource, nil, err
+	}
+
+	resp, _, err := c.Do(ctx, req, &resource, false)
+	if err != nil {
+		return resource, nil, err
+	}
+
+	return resource, resp, nil
+}
+
+// StreamPushResult describes the stream recreated by StreamService.Push.
+type StreamPushResult struct {
+	Stream Stream
+	// ObjectIDs maps the IDs of the archived objects to the IDs of the created ones.
+	ObjectIDs map[string]string
+	// CommentIDs maps the IDs of the archived comments to the IDs of the created ones.
+	CommentIDs map[string]string
+}
+
+// Pull copies a stream, with every object and comment, into a StreamArchive.
+func (s *StreamService) Pull(ctx context.Context, streamID string) (*StreamArchive, error) {
+	archive, err := s.snapshot(ctx, streamID)
+	if err != nil {
+		return nil, err
+	}
+
+	comments, _, err := s.client.ListArchivedComments(ctx, streamBasePath, streamID)
+	if err != nil {
+		return nil, err
+	}
+	archive.Comments = append(archive.Comments, comments...)
+
+	for _, data := range archive.Objects {
+		var o Object
+		err = json.Unmarshal(data, &o)
+		if err != nil {
+			return nil, err
+		}
+		if len(o.Comments) == 0 {
+			continue
+		}
+
+		comments, _, err := s.client.ListArchivedComments(ctx, objectBasePath, o.ID)
+		if err != nil {
+			return nil, err
+		}
+		archive.Comments = append(archive.Comments, comments...)
+	}
+
+	return archive, nil
+}
+
+// snapshot fetches a stream and all its objects into an archive, without comments.
+func (s *StreamService) snapshot(ctx context.Context, streamID string) (*StreamArchive, error) {
+	stream, _, err := s.Get(ctx, streamID)
+	if err != nil {
+		return nil, err
+	}
+
+	archive := &StreamArchive{
+		Version:  StreamArchiveVersion,
+		Server:   s.client.APIURL.String(),
+		PulledAt: time.Now().UTC(),
+		Stream:   stream,
+	}
+
+	for i := 0; i < len(stream.Objects); i += archiveBulkSize {
+		end := i + archiveBulkSize
+		if end > len(stream.Objects) {
+			end = len(stream.Objects)
+		}
+
+		var objects []json.RawMessage
+		if s.client.objectStore != nil {
+			objects, _, err = s.client.Object.getBulkStored(ctx, stream.Objects[i:end])
+		} else {
+			ids := make(ObjectGetBulkIDs, 0, end-i)
+			for _, o := range stream.Objects[i:end] {
+				ids = append(ids, o.ID)
+			}
+			objects, _, err = s.client.Object.getBulk(ctx, ids, nil)
+		}
+		if err != nil {
+			return nil, err
+		}
+		archive.Objects = append(archive.Objects, objects...)
+	}
+
+	fetched := map[string]bool{}
+	for _, data := range archive.Objects {
+		var keys struct {
+			ID string `json:"_id"`
+		}
+		err = json.Unmarshal(data, &keys)
+		if err != nil {
+			return nil, err
+		}
+		fetched[keys.ID] = true
+	}
+	for _, o := range stream.Objects {
+		if !fetched[o.ID] {
+			return nil, fmt.Errorf("object %v of stream %v could not be fetched", o.ID, streamID)
+		}
+	}
+
+	return archive, nil
+}
+
+// StreamPushOptions configures StreamService.Push.
+type StreamPushOptions struct {
+	// Created maps the archived objects, stream and comments that an interrupted push
+	// already created to their new IDs. They aren't created again.
+	Created map[string]string
+	// Accounts maps account IDs of the archive's server to accounts of the receiving
+	// server. Permissions and comment assignees are remapped through it, dropping the
+	// accounts it doesn't map. Without it, they aren't pushed.
+	Accounts map[string]string
+	// OnCreate is called with the archived and the new ID of every object, stream and
+	// comment created, e.g. to checkpoint the push.
+	OnCreate func(id string, newID string) error
+}
+
+// Push recreates an archived stream. Objects and comments are created anew, and the
+// stream's object references, the references between objects and the resources of
+// comments are remapped to the new IDs. Owners, parents and children refer to
+// accounts and streams of the archive's server, so they aren't pushed. opts may be nil.
+func (s *StreamService) Push(ctx context.Context, archive *StreamArchive, opts *StreamPushOptions) (StreamPushResult, error) {
+	if opts == nil {
+		opts = &StreamPushOptions{}
+	}
+
+	result := StreamPushResult{
+		ObjectIDs:  map[string]string{},
+		CommentIDs: map[string]string{},
+	}
+
+	created := func(ids map[string]string, id string, newID string) error {
+		ids[id] = newID
+		if opts.OnCreate != nil {
+			return opts.OnCreate(id, newID)
+		}
+		return nil
+	}
+
+	type archivedObject struct {
+		id   string
+		body map[string]interface{}
+	}
+
+	objects := make([]archivedObject, 0, len(archive.Objects))
+	for _, data := range archive.Objects {
+		var body map[string]interface{}
+		err := json.Unmarshal(data, &body)
+		if err != nil {
+			return result, err
+		}
+
+		id, _ := body["_id"].(string)
+		canRead := stringSlice(body["canRead"])
+		canWrite := stringSlice(body["canWrite"])
+		for _, field := range objectServerFields {
+			delete(body, field)
+		}
+		if opts.Accounts != nil {
+			body["canRead"] = remapAccounts(canRead, opts.Accounts)
+			body["canWrite"] = remapAccounts(canWrite, opts.Accounts)
+		}
+		objects = append(objects, archivedObject{id: id, body: body})
+	}
+
+	// Objects are created first, so that references to them can be remapped.
+	for _, o := range objects {
+		if _, ok := result.ObjectIDs[o.id]; ok {
+			continue
+		}
+		if newID, ok := opts.Created[o.id]; ok {
+			result.ObjectIDs[o.id] = newID
+			continue
+		}
+
+		object, _, err := s.client.Object.createRaw(ctx, o.body)
+		if err != nil {
+			return result, fmt.Errorf("creating object %v: %v", o.id, err)
+		}
+		err = created(result.ObjectIDs, o.id, object.ID)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	for _, o := range objects {
+		if !remapReferences(o.body, result.ObjectIDs) {
+			continue
+		}
+
+		newID := result.ObjectIDs[o.id]
+		_, err := s.client.Object.updateRaw(ctx, newID, o.body)
+		if err != nil {
+			return result, fmt.Errorf("updating the references of object %v: %v", newID, err)
+		}
+	}
+
+	if newID, ok := opts.Created[archive.Stream.StreamID]; ok {
+		stream, _, err := s.Get(ctx, newID)
+		if err != nil {
+			return result, err
+		}
+		result.Stream = stream
+	} else {
+		request := archive.Stream.Request()
+		request.CanRead = remapAccounts(archive.Stream.CanRead, opts.Accounts)
+		request.CanWrite = remapAccounts(archive.Stream.CanWrite, opts.Accounts)
+		request.Parent = nil
+		request.Children = nil
+
+		request.Objects = make([]*Object, 0, len(archive.Stream.Objects))
+		for _, placeholder := range archive.Stream.Objects {
+			id, ok := result.ObjectIDs[placeholder.ID]
+			if !ok {
+				return result, fmt.Errorf("the archive doesn't hold object %v of the stream", placeholder.ID)
+			}
+
+			o := &Object{Type: "Placeholder"}
+			o.ID = id
+			request.Objects = append(request.Objects, o)
+		}
+
+		stream, _, err := s.Create(ctx, request)
+		if err != nil {
+			return result, err
+		}
+		result.Stream = stream
+
+		if opts.OnCreate != nil {
+			err = opts.OnCreate(archive.Stream.StreamID, stream.StreamID)
+			if err != nil {
+				return result, err
+			}
+		}
+	}
+
+	for _, c := range archive.Comments {
+		if newID, ok := opts.Created[c.ID]; ok {
+			result.CommentIDs[c.ID] = newID
+			continue
+		}
+
+		var comment ArchivedComment
+		var err error
+
+		request := c
+		request.CanRead = remapAccounts(c.CanRead, opts.Accounts)
+		request.CanWrite = remapAccounts(c.CanWrite, opts.Accounts)
+		request.AssignedTo = remapAccounts(c.AssignedTo, opts.Accounts)
+
+		switch c.Resource.ResourceType {
+		case streamBasePath, "stream":
+			comment, _, err = s.client.CreateArchivedComment(ctx, streamBasePath, result.Stream.StreamID, request)
+		case objectBasePath, "object":
+			id, ok := result.ObjectIDs[c.Resource.ResourceID]
+			if !ok {
+				return result, fmt.Errorf("comment %v is on object %v, which the archive doesn't hold", c.ID, c.Resource.ResourceID)
+			}
+			comment, _, err = s.client.CreateArchivedComment(ctx, objectBasePath, id, request)
+		default:
+			return result, fmt.Errorf("comment %v is on a %v, which can't be pushed", c.ID, c.Resource.ResourceType)
+		}
+		if err != nil {
+			return result, fmt.Errorf("creating comment %v: %v", c.ID, err)
+		}
+
+		err = created(result.CommentIDs, c.ID, comment.ID)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// remapAccounts maps account IDs through accounts, dropping those it doesn't map. It
+// returns nil if accounts is nil.
+func remapAccounts(ids []string, accounts map[string]string) []string {
+	if accounts == nil {
+		return nil
+	}
+
+	var mapped []string
+	for _, id := range ids {
+		if newID, ok := accounts[id]; ok && newID != "" {
+			mapped = append(mapped, newID)
+		}
+	}
+	return mapped
+}
+
+// stringSlice returns the strings of a decoded JSON array.
+func stringSlice(v interface{}) []string {
+	values, _ := v.([]interface{})
+
+	var strs []string
+	for _, value := range values {
+		if str, ok := value.(string); ok {
+			strs = append(strs, str)
+		}
+	}
+	return strs
+}
+
+// remapReferences replaces the IDs in the reference fields of an object, reporting
+// whether any was replaced. IDs of objects the archive doesn't hold are kept.
+func remapReferences(body map[string]interface{}, ids map[string]string) bool {
+	changed := false
+
+	for _, field := range objectReferenceFields {
+		refs, ok := body[field].([]interface{})
+		if !ok {
+			continue
+		}
+
+		for i, ref := range refs {
+			id, ok := ref.(string)
+			if !ok {
+				continue
+			}
+			if newID, ok := ids[id]; ok {
+				refs[i] = newID
+				changed = true
+			}
+		}
+	}
+
+	return changed
+}
+
+// Write writes the archive as a zip file holding archive.json, stream.json,
+// layers.json, comments.json and one objects/<_id>.json per object.
+func (a *StreamArchive) Write(w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	stream := a.Stream
+	stream.Layers = nil
+
+	entries := []struct {
+		name  string
+		value interface{}
+	}{
+		{archiveManifestEntry, a},
+		{archiveStreamEntry, stream},
+		{archiveLayersEntry, a.Stream.Layers},
+		{archiveCommentsEntry, a.Comments},
+	}
+	for _, e := range entries {
+		data, err := json.MarshalIndent(e.value, "", "  ")
+		if err != nil {
+			return err
+		}
+		err = writeZipEntry(zw, e.name, data)
+		if err != nil {
+			return err
+		}
+	}
+
+	written := map[string]bool{}
+	for i, data := range a.Objects {
+		var keys struct {
+			ID string `json:"_id"`
+		}
+		err := json.Unmarshal(data, &keys)
+		if err != nil {
+			return err
+		}
+		if keys.ID == "" {
+			return fmt.Errorf("object %v of the archive has no _id", i)
+		}
+		if written[keys.ID] {
+			continue
+		}
+		written[keys.ID] = true
+
+		err = writeZipEntry(zw, archiveObjectsDir+keys.ID+".json", data)
+		if err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+func writeZipEntry(zw *zip.Writer, name string, data []byte) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
+
+// ReadStreamArchive reads an archive written by StreamArchive.Write. Objects are
+// returned in the order of the stream's objects.
+func ReadStreamArchive(r io.ReaderAt, size int64) (*StreamArchive, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	archive := new(StreamArchive)
+	objects := map[string]json.RawMessage{}
+	found := map[string]bool{}
+
+	for _, f := range zr.File {
+		data, err := readZipEntry(f)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case f.Name == archiveManifestEntry:
+			err = json.Unmarshal(data, archive)
+		case f.Name == archiveStreamEntry:
+			err = json.Unmarshal(data, &archive.Stream)
+		case f.Name == archiveLayersEntry:
+			var layers []Layer
+			err = json.Unmarshal(data, &layers)
+			archive.Stream.Layers = layers
+		case f.Name == archiveCommentsEntry:
+			err = json.Unmarshal(data, &archive.Comments)
+		case strings.HasPrefix(f.Name, archiveObjectsDir):
+			objects[strings.TrimSuffix(path.Base(f.Name), ".json")] = data
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", f.Name, err)
+		}
+		found[f.Name] = true
+	}
+
+	for _, name := range []string{archiveManifestEntry, archiveStreamEntry} {
+		if !found[name] {
+			return nil, fmt.Errorf("not a stream archive: %v is missing", name)
+		}
+	}
+	if archive.Version > StreamArchiveVersion {
+		return nil, fmt.Errorf("the archive has version %v, this version of gospeckle reads up to %v", archive.Version, StreamArchiveVersion)
+	}
+
+	var missing []string
+	added := map[string]bool{}
+	for _, placeholder := range archive.Stream.Objects {
+		data, ok := objects[placeholder.ID]
+		if !ok {
+			missing = append(missing, placeholder.ID)
+			continue
+		}
+		// A stream can reference an object more than once.
+		if !added[placeholder.ID] {
+			archive.Objects = append(archive.Objects, data)
+			added[placeholder.ID] = true
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("the archive is missing objects %v", strings.Join(missing, ", "))
+	}
+
+	return archive, nil
+}
+
+func readZipEntry(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return ioutil.ReadAll(rc)
+}
+
+// createRaw creates an object from its JSON body, keeping fields Object doesn't
+// declare.
+func (s *ObjectService) createRaw(ctx context.Context, body map[string]interface{}) (Object, *http.Response, error) {
+	resource := new(Object)
+
+	req, err := s.client.NewRequest(ctx, http.MethodPost, objectBasePath, body)
+	if err != nil {
+		return *resource, nil, err
+	}
+
+	resp, _, err := s.client.Do(ctx, req, resource, false)
+	if err != nil {
+		return *resource, nil, err
+	}
+
+	return *resource, resp, nil
+}
+
+// updateRaw updates an object from its JSON body, keeping fields Object doesn't
+// declare.
+func (s *ObjectService) updateRaw(ctx context.Context, id string, body map[string]interface{}) (*http.Response, error) {
+	s.forget(id)
+
+	req, err := s.client.NewRequest(ctx, http.MethodPut, objectBasePath+"/"+id, body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, _, err := s.client.Do(ctx, req, nil, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,286 @@
+package gospeckle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// cacheStatusHeader is set on responses served by a Cache, to hit, stale or revalidated.
+const cacheStatusHeader = "X-Gospeckle-Cache"
+
+// OfflineError is returned for requests that can't be served from the cache while the
+// client is offline.
+type OfflineError struct {
+	Method string
+	URL    string
+}
+
+func (e *OfflineError) Error() string {
+	if e.Method != http.MethodGet {
+		return fmt.Sprintf("offline: cannot send %v %v", e.Method, e.URL)
+	}
+	return fmt.Sprintf("offline: no cached response for GET %v", e.URL)
+}
+
+// Cache is an on-disk cache of GET responses. Responses are keyed by URL and by the
+// token they were requested with, so that users sharing a cache don't see each other's
+// resources. A cached response is served as is until it is older than TTL; after that
+// it is revalidated with its ETag or Last-Modified date when the server sent them, and
+// fetched again otherwise. Requests with any other method invalidate the cached
+// responses of their URL and of its parent collection.
+type Cache struct {
+	Dir string
+	TTL time.Duration
+	// Offline serves requests from the cache only, failing with an OfflineError when
+	// a response isn't cached.
+	Offline bool
+}
+
+// CacheEntry is a cached response.
+type CacheEntry struct {
+	URL          string      `json:"url"`
+	StoredAt     time.Time   `json:"storedAt"`
+	ETag         string      `json:"etag,omitempty"`
+	LastModified string      `json:"lastModified,omitempty"`
+	StatusCode   int         `json:"statusCode"`
+	Header       http.Header `json:"header"`
+	Body         []byte      `json:"body"`
+	// Path is the file the entry is stored in.
+	Path string `json:"-"`
+}
+
+// NewCache returns a Cache storing responses in dir.
+func NewCache(dir string, ttl time.Duration) *Cache {
+	return &Cache{Dir: dir, TTL: ttl}
+}
+
+// SetCache makes the client serve GET requests through cache. A nil cache disables
+// caching.
+func (c *Client) SetCache(cache *Cache) {
+	c.cache = cache
+}
+
+// send sends a request through the client's cache, if it has one.
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	if c.cache == nil {
+		return c.client.Do(req)
+	}
+	return c.cache.do(c.client, req)
+}
+
+func (cache *Cache) do(client *http.Client, req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		if cache.Offline {
+			return nil, &OfflineError{Method: req.Method, URL: req.URL.String()}
+		}
+
+		cache.invalidate(req.URL)
+		return client.Do(req)
+	}
+
+	entryPath := cache.entryPath(req.URL, req.Header.Get("Authorization"))
+	entry, _ := readCacheEntry(entryPath)
+
+	if cache.Offline {
+		if entry == nil {
+			return nil, &OfflineError{Method: req.Method, URL: req.URL.String()}
+		}
+		return entry.response(req, "hit"), nil
+	}
+
+	if entry != nil && time.Since(entry.StoredAt) < cache.TTL {
+		return entry.response(req, "hit"), nil
+	}
+
+	if entry != nil {
+		req = req.Clone(req.Context())
+		if entry.ETag != "" {
+			req.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		// Poor connectivity is the reason to have a cache, so a stale response is
+		// better than none.
+		if entry != nil && req.Context().Err() == nil {
+			return entry.response(req, "stale"), nil
+		}
+		return nil, err
+	}
+
+	if entry != nil && resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+
+		entry.StoredAt = time.Now()
+		writeCacheEntry(entry)
+		return entry.response(req, "revalidated"), nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	writeCacheEntry(&CacheEntry{
+		URL:          req.URL.String(),
+		StoredAt:     time.Now(),
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		StatusCode:   resp.StatusCode,
+		Header:       resp.Header,
+		Body:         body,
+		Path:         entryPath,
+	})
+
+	return resp, nil
+}
+
+// entryPath returns the file a response is cached in. Entries are grouped by URL so
+// that a URL can be invalidated for every token at once.
+func (cache *Cache) entryPath(u *url.URL, token string) string {
+	return filepath.Join(cache.urlDir(u), hashHex(token)[:16]+".json")
+}
+
+func (cache *Cache) urlDir(u *url.URL) string {
+	return filepath.Join(cache.Dir, hashHex(u.String()))
+}
+
+// invalidate removes the cached responses of a URL, of the same URL without its query
+// or trailing slash and of its parent collection, which lists the resource.
+func (cache *Cache) invalidate(u *url.URL) {
+	withoutQuery := *u
+	withoutQuery.RawQuery = ""
+	withoutQuery.Path = strings.TrimSuffix(u.Path, "/")
+
+	parent := withoutQuery
+	parent.Path = path.Dir(withoutQuery.Path)
+
+	for _, v := range []url.URL{*u, withoutQuery, parent} {
+		os.RemoveAll(cache.urlDir(&v))
+	}
+}
+
+// Entries returns every cached response, whichever token it was requested with.
+func (cache *Cache) Entries() ([]CacheEntry, error) {
+	var entries []CacheEntry
+
+	err := filepath.Walk(cache.Dir, func(p string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(p) != ".json" {
+			return nil
+		}
+
+		entry, err := readCacheEntry(p)
+		if err != nil {
+			return nil
+		}
+		entries = append(entries, *entry)
+		return nil
+	})
+
+	return entries, err
+}
+
+// Size returns the disk space used by the cache in bytes.
+func (cache *Cache) Size() (int64, error) {
+	var size int64
+
+	err := filepath.Walk(cache.Dir, func(p string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+
+	return size, err
+}
+
+// Clear removes every cached response.
+func (cache *Cache) Clear() error {
+	return os.RemoveAll(cache.Dir)
+}
+
+// response returns the cached response as an http.Response to req.
+func (e *CacheEntry) response(req *http.Request, status string) *http.Response {
+	header := http.Header{}
+	for k, v := range e.Header {
+		header[k] = v
+	}
+	header.Set(cacheStatusHeader, status)
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %v", e.StatusCode, http.StatusText(e.StatusCode)),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+func readCacheEntry(p string) (*CacheEntry, error) {
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := new(CacheEntry)
+	err = json.Unmarshal(data, entry)
+	if err != nil {
+		return nil, err
+	}
+	entry.Path = p
+
+	return entry, nil
+}
+
+// writeCacheEntry stores an entry, replacing the previous file atomically. Failing to
+// cache a response doesn't fail the request, so errors are ignored.
+func writeCacheEntry(e *CacheEntry) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	writeFileAtomic(e.Path, data)
+}
+
+func hashHex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,104 @@
+package gospeckle
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCacheInvalidate(t *testing.T) {
+	cached := []string{
+		"http://speckle.test/api/v1/streams",
+		"http://speckle.test/api/v1/streams?omit=objects",
+		"http://speckle.test/api/v1/streams/abc",
+		"http://speckle.test/api/v1/streams/abc?fields=name",
+		"http://speckle.test/api/v1/streams/abc/objects",
+		"http://speckle.test/api/v1/streams/def",
+		"http://speckle.test/api/v1/projects",
+	}
+
+	tests := []struct {
+		name        string
+		url         string
+		invalidated []string
+	}{
+		{
+			name: "resource",
+			url:  "http://speckle.test/api/v1/streams/abc",
+			invalidated: []string{
+				"http://speckle.test/api/v1/streams",
+				"http://speckle.test/api/v1/streams/abc",
+			},
+		},
+		{
+			name: "resource with query",
+			url:  "http://speckle.test/api/v1/streams/abc?fields=name",
+			invalidated: []string{
+				"http://speckle.test/api/v1/streams",
+				"http://speckle.test/api/v1/streams/abc",
+				"http://speckle.test/api/v1/streams/abc?fields=name",
+			},
+		},
+		{
+			name: "trailing slash",
+			url:  "http://speckle.test/api/v1/streams/abc/",
+			invalidated: []string{
+				"http://speckle.test/api/v1/streams",
+				"http://speckle.test/api/v1/streams/abc",
+			},
+		},
+		{
+			name: "sub-collection",
+			url:  "http://speckle.test/api/v1/streams/abc/objects",
+			invalidated: []string{
+				"http://speckle.test/api/v1/streams/abc",
+				"http://speckle.test/api/v1/streams/abc/objects",
+			},
+		},
+		{
+			name: "collection",
+			url:  "http://speckle.test/api/v1/streams",
+			invalidated: []string{
+				"http://speckle.test/api/v1/streams",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "gospeckle-cache")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			cache := NewCache(dir, time.Minute)
+			for _, raw := range cached {
+				for _, token := range []string{"token-a", "token-b"} {
+					u, _ := url.Parse(raw)
+					writeCacheEntry(&CacheEntry{URL: raw, StatusCode: 200, Path: cache.entryPath(u, token)})
+				}
+			}
+
+			u, _ := url.Parse(test.url)
+			cache.invalidate(u)
+
+			invalidated := map[string]bool{}
+			for _, raw := range test.invalidated {
+				invalidated[raw] = true
+			}
+
+			for _, raw := range cached {
+				for _, token := range []string{"token-a", "token-b"} {
+					u, _ := url.Parse(raw)
+					_, err := readCacheEntry(cache.entryPath(u, token))
+					if found := err == nil; found == invalidated[raw] {
+						t.Errorf("%v with %v: found %v, want %v", raw, token, found, !invalidated[raw])
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package gospeckle
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestGetComments(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"success": true, "resources": [
+			{"_id": "c1", "text": "first", "resource": {"resourceType": "stream", "resourceId": "s1"}},
+			{"_id": "c2", "text": "second", "resource": {"resourceType": "stream", "resourceId": "s1"}}
+		]}`))
+	}))
+	defer server.Close()
+
+	apiURL, _ := url.Parse(server.URL)
+	client := NewClient(nil, apiURL, nil, "v1", "token")
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		get  func(id string) ([]Comment, *http.Response, error)
+	}{
+		{name: "objects", get: func(id string) ([]Comment, *http.Response, error) { return client.Object.GetComments(ctx, id) }},
+		{name: "projects", get: func(id string) ([]Comment, *http.Response, error) { return client.Project.GetComments(ctx, id) }},
+		{name: "streams", get: func(id string) ([]Comment, *http.Response, error) { return client.Stream.GetComments(ctx, id) }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			comments, _, err := test.get("s1")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var texts []string
+			for _, c := range comments {
+				texts = append(texts, c.Text)
+			}
+			want := []string{"first", "second"}
+			if !reflect.DeepEqual(texts, want) {
+				t.Errorf("got %v, want %v", texts, want)
+			}
+		})
+	}
+}
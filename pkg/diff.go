@@ -0,0 +1,357 @@
+package gospeckle
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Kinds of changes in a StreamChanges.
+const (
+	ChangeAdded    = "added"
+	ChangeRemoved  = "removed"
+	ChangeModified = "modified"
+)
+
+// Ways objects of two streams are matched, tried in this order.
+const (
+	MatchApplicationID = "applicationId"
+	MatchHash          = "hash"
+	MatchID            = "_id"
+)
+
+// objectDiffIgnoredFields are the fields of an object left out of its property
+// diff: those set by the server, and the hashes, which change with the content
+// they are computed from.
+var objectDiffIgnoredFields = append([]string{"hash", "geometryHash"}, objectServerFields...)
+
+// StreamChanges is the difference between two streams, computed locally by
+// StreamService.Compare. Unlike StreamService.Diff, objects are matched by
+// application ID, hash or ID, and the changes to each object are listed.
+type StreamChanges struct {
+	StreamA string `json:"streamA"`
+	StreamB string `json:"streamB"`
+	// Objects lists the objects added to, removed from or modified in stream B,
+	// compared to stream A.
+	Objects []ObjectChange `json:"objects"`
+	// Unchanged is the number of objects found unchanged in both streams.
+	Unchanged int           `json:"unchanged"`
+	Layers    []LayerChange `json:"layers"`
+}
+
+// ObjectChange is an object added, removed or modified between two streams.
+type ObjectChange struct {
+	Kind string `json:"kind"`
+	// MatchedBy tells how a modified object was found in both streams.
+	MatchedBy string `json:"matchedBy,omitempty"`
+	// A and B are the object's IDs in each stream, empty in the stream it isn't in.
+	A             string `json:"a,omitempty"`
+	B             string `json:"b,omitempty"`
+	ApplicationID string `json:"applicationId,omitempty"`
+	Type          string `json:"type,omitempty"`
+	Name          string `json:"name,omitempty"`
+	// GeometryChanged is set when the object's geometry hash differs.
+	GeometryChanged bool             `json:"geometryChanged,omitempty"`
+	GeometryHashA   string           `json:"geometryHashA,omitempty"`
+	GeometryHashB   string           `json:"geometryHashB,omitempty"`
+	Properties      []PropertyChange `json:"properties,omitempty"`
+}
+
+// LayerChange is a layer added, removed or modified between two streams. Layers
+// are matched by GUID, then by name.
+type LayerChange struct {
+	Kind       string           `json:"kind"`
+	GUID       string           `json:"guid,omitempty"`
+	Name       string           `json:"name,omitempty"`
+	Properties []PropertyChange `json:"properties,omitempty"`
+}
+
+// PropertyChange is a value added, removed or modified in a JSON document. Path
+// locates it, as in properties.area or children[2].
+type PropertyChange struct {
+	Kind string      `json:"kind"`
+	Path string      `json:"path"`
+	A    interface{} `json:"a"`
+	B    interface{} `json:"b"`
+}
+
+// Compare fetches two streams, or two clones of a stream, with all their objects
+// and computes their differences locally with CompareStreams.
+func (s *StreamService) Compare(ctx context.Context, streamA string, streamB string) (*StreamChanges, error) {
+	a, err := s.snapshot(ctx, streamA)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := s.snapshot(ctx, streamB)
+	if err != nil {
+		return nil, err
+	}
+
+	return CompareStreams(a, b)
+}
+
+// diffObject is an object of a stream being compared.
+type diffObject struct {
+	Object
+	fields  map[string]interface{}
+	matched bool
+}
+
+// CompareStreams computes the differences between the objects and layers of two
+// archived streams. Objects are matched by application ID, then by hash, then by
+// ID, and the objects that don't match are added or removed. References to other
+// objects, such as children, are compared by the objects they match, and are
+// reported with stream A's IDs.
+func CompareStreams(a *StreamArchive, b *StreamArchive) (*StreamChanges, error) {
+	changes := &StreamChanges{StreamA: a.Stream.StreamID, StreamB: b.Stream.StreamID}
+
+	objectsA, err := diffObjects(a.Objects)
+	if err != nil {
+		return nil, fmt.Errorf("stream %v: %v", a.Stream.StreamID, err)
+	}
+	objectsB, err := diffObjects(b.Objects)
+	if err != nil {
+		return nil, fmt.Errorf("stream %v: %v", b.Stream.StreamID, err)
+	}
+
+	keys := []struct {
+		match string
+		key   func(o *diffObject) string
+	}{
+		{MatchApplicationID, func(o *diffObject) string { return o.ApplicationID }},
+		{MatchHash, func(o *diffObject) string { return o.Hash }},
+		{MatchID, func(o *diffObject) string { return o.ID }},
+	}
+
+	type match struct {
+		a, b *diffObject
+		by   string
+	}
+	var matches []match
+
+	for _, k := range keys {
+		unmatched := map[string][]*diffObject{}
+		for _, o := range objectsB {
+			if key := k.key(o); !o.matched && key != "" {
+				unmatched[key] = append(unmatched[key], o)
+			}
+		}
+
+		for _, oa := range objectsA {
+			key := k.key(oa)
+			if oa.matched || key == "" || len(unmatched[key]) == 0 {
+				continue
+			}
+			ob := unmatched[key][0]
+			unmatched[key] = unmatched[key][1:]
+			oa.matched, ob.matched = true, true
+			matches = append(matches, match{oa, ob, k.match})
+		}
+	}
+
+	// Objects refer to each other by ID, and matched objects have different IDs in
+	// each stream, so the references of stream B are mapped to stream A's IDs first.
+	ids := map[string]string{}
+	for _, m := range matches {
+		ids[m.b.ID] = m.a.ID
+	}
+	for _, m := range matches {
+		remapReferences(m.b.fields, ids)
+
+		change := compareObjects(m.a, m.b)
+		if change == nil {
+			changes.Unchanged++
+			continue
+		}
+		change.MatchedBy = m.by
+		changes.Objects = append(changes.Objects, *change)
+	}
+
+	for _, o := range objectsA {
+		if !o.matched {
+			changes.Objects = append(changes.Objects, objectChange(ChangeRemoved, o, nil))
+		}
+	}
+	for _, o := range objectsB {
+		if !o.matched {
+			changes.Objects = append(changes.Objects, objectChange(ChangeAdded, nil, o))
+		}
+	}
+
+	changes.Layers = compareLayers(a.Stream.Layers, b.Stream.Layers)
+
+	return changes, nil
+}
+
+// diffObjects decodes the objects of a stream, leaving out duplicates.
+func diffObjects(objects []json.RawMessage) ([]*diffObject, error) {
+	decoded := make([]*diffObject, 0, len(objects))
+	seen := map[string]bool{}
+
+	for _, data := range objects {
+		o := &diffObject{}
+		err := json.Unmarshal(data, &o.Object)
+		if err == nil {
+			err = json.Unmarshal(data, &o.fields)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if seen[o.ID] {
+			continue
+		}
+		seen[o.ID] = true
+
+		for _, field := range objectDiffIgnoredFields {
+			delete(o.fields, field)
+		}
+		decoded = append(decoded, o)
+	}
+
+	return decoded, nil
+}
+
+// compareObjects returns the changes between two matched objects, or nil if there
+// are none.
+func compareObjects(a *diffObject, b *diffObject) *ObjectChange {
+	properties := DiffJSON(a.fields, b.fields)
+	if len(properties) == 0 && a.GeometryHash == b.GeometryHash {
+		return nil
+	}
+
+	change := objectChange(ChangeModified, a, b)
+	change.Properties = properties
+	return &change
+}
+
+func objectChange(kind string, a *diffObject, b *diffObject) ObjectChange {
+	change := ObjectChange{Kind: kind}
+
+	if a != nil {
+		change.A = a.ID
+		change.ApplicationID, change.Type, change.Name = a.ApplicationID, a.Type, a.Name
+		change.GeometryHashA = a.GeometryHash
+	}
+	if b != nil {
+		change.B = b.ID
+		change.ApplicationID, change.Type, change.Name = b.ApplicationID, b.Type, b.Name
+		change.GeometryHashB = b.GeometryHash
+	}
+	change.GeometryChanged = kind == ChangeModified && change.GeometryHashA != change.GeometryHashB
+
+	return change
+}
+
+// compareLayers matches the layers of two streams by GUID, then by name.
+func compareLayers(a []Layer, b []Layer) []LayerChange {
+	var changes []LayerChange
+	matched := make([]bool, len(b))
+
+	find := func(layer Layer) int {
+		for i, other := range b {
+			if !matched[i] && layer.GUID != "" && layer.GUID == other.GUID {
+				return i
+			}
+		}
+		for i, other := range b {
+			if !matched[i] && layer.Name == other.Name {
+				return i
+			}
+		}
+		return -1
+	}
+
+	for _, layer := range a {
+		i := find(layer)
+		if i < 0 {
+			changes = append(changes, LayerChange{Kind: ChangeRemoved, GUID: layer.GUID, Name: layer.Name})
+			continue
+		}
+		matched[i] = true
+
+		properties := DiffJSON(layerFields(layer), layerFields(b[i]))
+		if len(properties) > 0 {
+			changes = append(changes, LayerChange{Kind: ChangeModified, GUID: b[i].GUID, Name: b[i].Name, Properties: properties})
+		}
+	}
+
+	for i, layer := range b {
+		if !matched[i] {
+			changes = append(changes, LayerChange{Kind: ChangeAdded, GUID: layer.GUID, Name: layer.Name})
+		}
+	}
+
+	return changes
+}
+
+// layerFields returns a layer as decoded JSON, to be diffed like objects are.
+func layerFields(layer Layer) interface{} {
+	var fields interface{}
+	data, _ := json.Marshal(layer)
+	json.Unmarshal(data, &fields)
+	return fields
+}
+
+// DiffJSON lists the differences between two decoded JSON values. Objects are
+// compared key by key, and arrays of the same length item by item. Arrays whose
+// length changed are reported as a whole.
+func DiffJSON(a interface{}, b interface{}) []PropertyChange {
+	var changes []PropertyChange
+	diffJSON("", a, b, &changes)
+	return changes
+}
+
+func diffJSON(path string, a interface{}, b interface{}, changes *[]PropertyChange) {
+	switch {
+	case a == nil && b != nil:
+		*changes = append(*changes, PropertyChange{Kind: ChangeAdded, Path: path, B: b})
+		return
+	case a != nil && b == nil:
+		*changes = append(*changes, PropertyChange{Kind: ChangeRemoved, Path: path, A: a})
+		return
+	}
+
+	mapA, okA := a.(map[string]interface{})
+	mapB, okB := b.(map[string]interface{})
+	if okA && okB {
+		keys := map[string]bool{}
+		for key := range mapA {
+			keys[key] = true
+		}
+		for key := range mapB {
+			keys[key] = true
+		}
+
+		sorted := make([]string, 0, len(keys))
+		for key := range keys {
+			sorted = append(sorted, key)
+		}
+		sort.Strings(sorted)
+
+		for _, key := range sorted {
+			keyPath := key
+			if path != "" {
+				keyPath = path + "." + key
+			}
+			diffJSON(keyPath, mapA[key], mapB[key], changes)
+		}
+		return
+	}
+
+	listA, okA := a.([]interface{})
+	listB, okB := b.([]interface{})
+	if okA && okB && len(listA) == len(listB) {
+		for i := range listA {
+			diffJSON(fmt.Sprintf("%v[%v]", path, i), listA[i], listB[i], changes)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(a, b) {
+		*changes = append(*changes, PropertyChange{Kind: ChangeModified, Path: path, A: a, B: b})
+	}
+}
@@ -0,0 +1,163 @@
+package gospeckle
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDiffJSON(t *testing.T) {
+	decode := func(s string) interface{} {
+		var v interface{}
+		if err := json.Unmarshal([]byte(s), &v); err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want []PropertyChange
+	}{
+		{
+			name: "equal",
+			a:    `{"a": 1, "b": [1, 2], "c": {"d": "x"}}`,
+			b:    `{"c": {"d": "x"}, "b": [1, 2], "a": 1}`,
+		},
+		{
+			name: "modified value",
+			a:    `{"area": 1}`,
+			b:    `{"area": 2}`,
+			want: []PropertyChange{{Kind: ChangeModified, Path: "area", A: 1.0, B: 2.0}},
+		},
+		{
+			name: "added and removed keys",
+			a:    `{"a": 1, "b": true}`,
+			b:    `{"b": true, "c": "x"}`,
+			want: []PropertyChange{
+				{Kind: ChangeRemoved, Path: "a", A: 1.0},
+				{Kind: ChangeAdded, Path: "c", B: "x"},
+			},
+		},
+		{
+			name: "nested",
+			a:    `{"properties": {"area": 1, "tags": {"x": "y"}}}`,
+			b:    `{"properties": {"area": 1, "tags": {"x": "z"}}}`,
+			want: []PropertyChange{{Kind: ChangeModified, Path: "properties.tags.x", A: "y", B: "z"}},
+		},
+		{
+			name: "array items",
+			a:    `{"value": [1, 2, 3]}`,
+			b:    `{"value": [1, 5, 3]}`,
+			want: []PropertyChange{{Kind: ChangeModified, Path: "value[1]", A: 2.0, B: 5.0}},
+		},
+		{
+			name: "array length",
+			a:    `{"value": [1, 2]}`,
+			b:    `{"value": [1, 2, 3]}`,
+			want: []PropertyChange{{Kind: ChangeModified, Path: "value", A: []interface{}{1.0, 2.0}, B: []interface{}{1.0, 2.0, 3.0}}},
+		},
+		{
+			name: "objects in arrays",
+			a:    `{"faces": [{"n": 1}, {"n": 2}]}`,
+			b:    `{"faces": [{"n": 1}, {"n": 3}]}`,
+			want: []PropertyChange{{Kind: ChangeModified, Path: "faces[1].n", A: 2.0, B: 3.0}},
+		},
+		{
+			name: "type change",
+			a:    `{"a": {"b": 1}}`,
+			b:    `{"a": [1]}`,
+			want: []PropertyChange{{Kind: ChangeModified, Path: "a", A: map[string]interface{}{"b": 1.0}, B: []interface{}{1.0}}},
+		},
+		{
+			name: "null",
+			a:    `{"a": null}`,
+			b:    `{"a": 1}`,
+			want: []PropertyChange{{Kind: ChangeAdded, Path: "a", B: 1.0}},
+		},
+		{
+			name: "top level",
+			a:    `1`,
+			b:    `2`,
+			want: []PropertyChange{{Kind: ChangeModified, Path: "", A: 1.0, B: 2.0}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := DiffJSON(decode(test.a), decode(test.b))
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCompareStreamsReferences(t *testing.T) {
+	archive := func(streamID string, objects ...string) *StreamArchive {
+		a := &StreamArchive{Stream: Stream{StreamID: streamID}}
+		for _, o := range objects {
+			a.Objects = append(a.Objects, json.RawMessage(o))
+		}
+		return a
+	}
+
+	tests := []struct {
+		name      string
+		a         *StreamArchive
+		b         *StreamArchive
+		unchanged int
+		want      []ObjectChange
+	}{
+		{
+			name: "references to matched objects",
+			a: archive("sa",
+				`{"_id": "a1", "applicationId": "line", "type": "Line", "children": ["a2"]}`,
+				`{"_id": "a2", "applicationId": "point", "type": "Point", "parent": ["a1"]}`,
+			),
+			b: archive("sb",
+				`{"_id": "b1", "applicationId": "line", "type": "Line", "children": ["b2"]}`,
+				`{"_id": "b2", "applicationId": "point", "type": "Point", "parent": ["b1"]}`,
+			),
+			unchanged: 2,
+		},
+		{
+			name: "reference to another object",
+			a: archive("sa",
+				`{"_id": "a1", "applicationId": "line", "type": "Line", "children": ["a2"]}`,
+				`{"_id": "a2", "applicationId": "point", "type": "Point"}`,
+			),
+			b: archive("sb",
+				`{"_id": "b1", "applicationId": "line", "type": "Line", "children": ["b3"]}`,
+				`{"_id": "b2", "applicationId": "point", "type": "Point"}`,
+				`{"_id": "b3", "applicationId": "other", "type": "Point"}`,
+			),
+			unchanged: 1,
+			want: []ObjectChange{
+				{
+					Kind: ChangeModified, MatchedBy: MatchApplicationID, A: "a1", B: "b1", ApplicationID: "line", Type: "Line",
+					Properties: []PropertyChange{{Kind: ChangeModified, Path: "children[0]", A: "a2", B: "b3"}},
+				},
+				{Kind: ChangeAdded, B: "b3", ApplicationID: "other", Type: "Point"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			changes, err := CompareStreams(test.a, test.b)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if changes.Unchanged != test.unchanged {
+				t.Errorf("unchanged: got %v, want %v", changes.Unchanged, test.unchanged)
+			}
+			if !reflect.DeepEqual(changes.Objects, test.want) {
+				t.Errorf("got %+v, want %+v", changes.Objects, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package gospeckle
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// Event names of the SpeckleServer v1 websocket protocol. Stream updates and client
+// presence are sent by the server as broadcasts whose args carry an eventType; those
+// are decoded using the eventType as the event name.
+const (
+	EventBroadcast       = "broadcast"
+	EventMessage         = "message"
+	EventJoinStream      = "join-stream"
+	EventLeaveStream     = "leave-stream"
+	EventVolatileMessage = "volatile-message"
+	EventUpdateGlobal    = "update-global"
+	EventUpdateMeta      = "update-meta"
+	EventUpdateChildren  = "update-children"
+	EventClientOnline    = "client-online"
+	EventClientOffline   = "client-offline"
+)
+
+// Event is a message received from the server through a websocket Session.
+type Event interface {
+	Header() EventHeader
+}
+
+// EventHandler handles an event received by a Session.
+type EventHandler func(ctx context.Context, e Event)
+
+// EventHeader holds the fields common to every event.
+type EventHeader struct {
+	EventName   string `json:"eventName"`
+	StreamID    string `json:"streamId,omitempty"`
+	SenderID    string `json:"senderId,omitempty"`
+	RecipientID string `json:"recipientId,omitempty"`
+	// Raw is the frame the event was decoded from.
+	Raw json.RawMessage `json:"-"`
+}
+
+// Header returns the event's header.
+func (h EventHeader) Header() EventHeader {
+	return h
+}
+
+// BroadcastEvent is a message sent to every client of a stream.
+type BroadcastEvent struct {
+	EventHeader
+	Args interface{} `json:"args"`
+}
+
+// MessageEvent is a message sent to a single client.
+type MessageEvent struct {
+	EventHeader
+	Args interface{} `json:"args"`
+}
+
+// VolatileMessageEvent is a message relayed by the server without being stored.
+type VolatileMessageEvent struct {
+	EventHeader
+	Args interface{} `json:"args"`
+}
+
+// JoinStreamEvent is sent when a client joins a stream's room.
+type JoinStreamEvent struct {
+	EventHeader
+	ClientID string `json:"clientId,omitempty"`
+}
+
+// LeaveStreamEvent is sent when a client leaves a stream's room.
+type LeaveStreamEvent struct {
+	EventHeader
+	ClientID string `json:"clientId,omitempty"`
+}
+
+// StreamUpdateEvent is sent when a stream's objects and layers have been replaced.
+type StreamUpdateEvent struct {
+	EventHeader
+	Args map[string]interface{} `json:"args"`
+}
+
+// StreamMetaUpdateEvent is sent when a stream's name, description or other
+// metadata has changed.
+type StreamMetaUpdateEvent struct {
+	EventHeader
+	Args map[string]interface{} `json:"args"`
+}
+
+// StreamChildrenUpdateEvent is sent when a stream has been cloned.
+type StreamChildrenUpdateEvent struct {
+	EventHeader
+	Args map[string]interface{} `json:"args"`
+}
+
+// ClientOnlineEvent is sent when a client of the stream comes online.
+type ClientOnlineEvent struct {
+	EventHeader
+	ClientID string `json:"clientId,omitempty"`
+}
+
+// ClientOfflineEvent is sent when a client of the stream goes offline.
+type ClientOfflineEvent struct {
+	EventHeader
+	ClientID string `json:"clientId,omitempty"`
+}
+
+// UnknownEvent is any frame that is not part of the protocol, including frames
+// that are not JSON.
+type UnknownEvent struct {
+	EventHeader
+}
+
+// eventFrame is the wire format of the messages exchanged through websockets. The
+// server sends event data as args, while WebsocketMessage uses payload.
+type eventFrame struct {
+	EventName   string          `json:"eventName"`
+	StreamID    string          `json:"streamId"`
+	SenderID    string          `json:"senderId"`
+	RecipientID string          `json:"recipientId"`
+	Args        json.RawMessage `json:"args"`
+	Payload     json.RawMessage `json:"payload"`
+}
+
+// eventArgs are the fields of a frame's args used to route and type an event.
+type eventArgs struct {
+	EventType string `json:"eventType"`
+	ClientID  string `json:"clientId"`
+}
+
+// DecodeEvent decodes a websocket frame into one of the typed events. Frames that
+// cannot be decoded are returned as an UnknownEvent.
+func DecodeEvent(data []byte) Event {
+	var frame eventFrame
+
+	header := EventHeader{Raw: data}
+
+	if err := json.Unmarshal(data, &frame); err != nil {
+		return &UnknownEvent{EventHeader: header}
+	}
+
+	header.EventName = frame.EventName
+	header.StreamID = frame.StreamID
+	header.SenderID = frame.SenderID
+	header.RecipientID = frame.RecipientID
+
+	args := frame.Args
+	if len(args) == 0 {
+		args = frame.Payload
+	}
+
+	var typed eventArgs
+	// args aren't always an object, in which case there is no eventType to read.
+	json.Unmarshal(args, &typed)
+
+	switch typed.EventType {
+	case EventUpdateGlobal, EventUpdateMeta, EventUpdateChildren, EventClientOnline, EventClientOffline:
+		header.EventName = typed.EventType
+	}
+
+	clientID := typed.ClientID
+	if clientID == "" {
+		clientID = frame.SenderID
+	}
+
+	switch header.EventName {
+	case EventBroadcast:
+		e := &BroadcastEvent{EventHeader: header}
+		json.Unmarshal(args, &e.Args)
+		return e
+	case EventMessage:
+		e := &MessageEvent{EventHeader: header}
+		json.Unmarshal(args, &e.Args)
+		return e
+	case EventVolatileMessage:
+		e := &VolatileMessageEvent{EventHeader: header}
+		json.Unmarshal(args, &e.Args)
+		return e
+	case EventJoinStream:
+		return &JoinStreamEvent{EventHeader: header, ClientID: clientID}
+	case EventLeaveStream:
+		return &LeaveStreamEvent{EventHeader: header, ClientID: clientID}
+	case EventUpdateGlobal:
+		e := &StreamUpdateEvent{EventHeader: header}
+		json.Unmarshal(args, &e.Args)
+		return e
+	case EventUpdateMeta:
+		e := &StreamMetaUpdateEvent{EventHeader: header}
+		json.Unmarshal(args, &e.Args)
+		return e
+	case EventUpdateChildren:
+		e := &StreamChildrenUpdateEvent{EventHeader: header}
+		json.Unmarshal(args, &e.Args)
+		return e
+	case EventClientOnline:
+		return &ClientOnlineEvent{EventHeader: header, ClientID: clientID}
+	case EventClientOffline:
+		return &ClientOfflineEvent{EventHeader: header, ClientID: clientID}
+	}
+
+	return &UnknownEvent{EventHeader: header}
+}
+
+// On registers a handler for an event name. Several handlers can be registered for
+// the same event; they are called in the order they were registered, from the
+// session's read loop, so they should not block.
+func (s *Session) On(eventName string, handler EventHandler) {
+	s.handlersMu.Lock()
+	defer s.handlersMu.Unlock()
+
+	if s.handlers == nil {
+		s.handlers = map[string][]EventHandler{}
+	}
+	s.handlers[eventName] = append(s.handlers[eventName], handler)
+}
+
+// OnUnknown registers the fallback handler, which receives every event that has no
+// handler registered with On, including frames that are not part of the protocol.
+func (s *Session) OnUnknown(handler EventHandler) {
+	s.handlersMu.Lock()
+	defer s.handlersMu.Unlock()
+
+	s.fallback = handler
+}
+
+// dispatch decodes a frame and routes it to the handlers registered for it.
+func (s *Session) dispatch(ctx context.Context, data []byte) {
+	e := DecodeEvent(data)
+
+	s.handlersMu.RLock()
+	handlers := s.handlers[e.Header().EventName]
+	fallback := s.fallback
+	taps := s.taps
+	s.handlersMu.RUnlock()
+
+	for _, tap := range taps {
+		tap(ctx, e)
+	}
+
+	if len(handlers) == 0 {
+		if fallback != nil {
+			fallback(ctx, e)
+		}
+		return
+	}
+
+	for _, h := range handlers {
+		h(ctx, e)
+	}
+}
@@ -0,0 +1,274 @@
+package gospeckle
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// StreamCommit is a version of a stream in its history. Every clone of a stream is
+// a version whose parent is the cloned stream.
+type StreamCommit struct {
+	StreamID      string
+	Name          string
+	CommitMessage string
+	Owner         string
+	CreatedAt     *time.Time
+	UpdatedAt     *time.Time
+	Parents       []string
+	Children      []string
+	// Missing is set for parents and children that can't be fetched, because they
+	// were deleted or aren't shared with the user.
+	Missing bool
+}
+
+// StreamCommitResult identifies the streams involved in a StreamService.Commit.
+type StreamCommitResult struct {
+	// CloneID is the clone keeping the stream's state from before the commit.
+	CloneID string
+	// StreamID is the updated stream.
+	StreamID string
+}
+
+// streamCommitRequest is the update a commit applies to a stream. Unlike
+// StreamRequest, empty objects, layers and parents are sent, so that they are cleared.
+type streamCommitRequest struct {
+	StreamRequest
+	Objects  []*Object `json:"objects"`
+	Layers   []*Layer  `json:"layers"`
+	Parent   []string  `json:"parents"`
+	Children []string  `json:"children"`
+}
+
+// Commit clones a stream to keep its current state in its history, with message
+// as the clone's commit message, then applies update to the stream itself. The
+// clone takes the stream's place in the lineage: it gets the stream's parents and
+// becomes the stream's only parent. Objects and layers that are nil in update are
+// left as they are. If the update fails, the result still holds the clone.
+func (s *StreamService) Commit(ctx context.Context, streamID string, update StreamRequest, message string) (StreamCommitResult, error) {
+	return s.commit(ctx, streamID, update, message)
+}
+
+// Revert commits the objects and layers of a clone back to a stream. The clone must
+// be part of the stream's history, and the stream's state before the revert is kept
+// in a new clone, so that a revert can be reverted too.
+func (s *StreamService) Revert(ctx context.Context, streamID string, cloneID string, message string) (StreamCommitResult, error) {
+	history, err := s.History(ctx, streamID)
+	if err != nil {
+		return StreamCommitResult{}, err
+	}
+
+	found := false
+	for _, commit := range history {
+		if commit.StreamID == cloneID && commit.StreamID != streamID && !commit.Missing {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return StreamCommitResult{}, fmt.Errorf("stream %v isn't part of the history of stream %v", cloneID, streamID)
+	}
+
+	clone, _, err := s.Get(ctx, cloneID)
+	if err != nil {
+		return StreamCommitResult{}, err
+	}
+
+	request := clone.Request()
+	return s.commit(ctx, streamID, StreamRequest{Objects: request.Objects, Layers: request.Layers}, message)
+}
+
+func (s *StreamService) commit(ctx context.Context, streamID string, update StreamRequest, message string) (StreamCommitResult, error) {
+	result := StreamCommitResult{StreamID: streamID}
+
+	stream, _, err := s.Get(ctx, streamID)
+	if err != nil {
+		return result, err
+	}
+
+	cloned, _, err := s.Clone(ctx, streamID, "")
+	if err != nil {
+		return result, err
+	}
+	result.CloneID = cloned.Clone.StreamID
+
+	previous := stream.Request()
+	clone := streamCommitRequest{
+		StreamRequest: StreamRequest{CommitMessage: message},
+		Objects:       previous.Objects,
+		Layers:        previous.Layers,
+		Parent:        append([]string{}, stream.Parent...),
+		Children:      []string{streamID},
+	}
+	err = s.put(ctx, result.CloneID, clone)
+	if err != nil {
+		return result, fmt.Errorf("recording clone %v as the previous state of stream %v: %v", result.CloneID, streamID, err)
+	}
+
+	commit := streamCommitRequest{
+		StreamRequest: update,
+		Objects:       update.Objects,
+		Layers:        update.Layers,
+		Parent:        []string{result.CloneID},
+		Children:      append([]string{}, stream.Children...),
+	}
+	if commit.Objects == nil {
+		commit.Objects = clone.Objects
+	}
+	if commit.Layers == nil {
+		commit.Layers = clone.Layers
+	}
+	err = s.put(ctx, streamID, commit)
+	if err != nil {
+		return result, fmt.Errorf("updating stream %v, its previous state is kept in clone %v: %v", streamID, result.CloneID, err)
+	}
+
+	for _, parentID := range stream.Parent {
+		parent, _, err := s.Get(ctx, parentID)
+		if err != nil {
+			if isMissing(err) {
+				continue
+			}
+			return result, err
+		}
+
+		children := make([]string, len(parent.Children))
+		for i, id := range parent.Children {
+			if id == streamID {
+				id = result.CloneID
+			}
+			children[i] = id
+		}
+		_, err = s.Update(ctx, parentID, StreamRequest{Children: children})
+		if err != nil {
+			return result, fmt.Errorf("replacing stream %v with clone %v in the children of %v: %v", streamID, result.CloneID, parentID, err)
+		}
+	}
+
+	return result, nil
+}
+
+// put sends an update to a stream that StreamRequest can't express.
+func (s *StreamService) put(ctx context.Context, id string, update interface{}) error {
+	req, err := s.client.NewRequest(ctx, http.MethodPut, streamBasePath+"/"+id, update)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = s.client.Do(ctx, req, nil, false)
+	return err
+}
+
+// isMissing reports whether a request failed because the resource was deleted or
+// isn't shared with the user.
+func isMissing(err error) bool {
+	errResp, ok := err.(*ErrorResponse)
+	return ok && (errResp.Response.StatusCode == http.StatusNotFound || errResp.Response.StatusCode == http.StatusForbidden)
+}
+
+// History walks the parents and children of a stream, and theirs in turn, and
+// returns every version found as a log. Versions are ordered newest first, and a
+// version always comes before its parents, like git log does.
+func (s *StreamService) History(ctx context.Context, streamID string) ([]StreamCommit, error) {
+	commits := map[string]*StreamCommit{}
+	queue := []string{streamID}
+
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if _, ok := commits[id]; ok {
+			continue
+		}
+
+		stream, _, err := s.Get(ctx, id)
+		if err != nil {
+			if id == streamID || !isMissing(err) {
+				return nil, err
+			}
+			commits[id] = &StreamCommit{StreamID: id, Missing: true}
+			continue
+		}
+
+		commits[id] = &StreamCommit{
+			StreamID:      stream.StreamID,
+			Name:          stream.Name,
+			CommitMessage: stream.CommitMessage,
+			Owner:         stream.Owner,
+			CreatedAt:     stream.CreatedAt,
+			UpdatedAt:     stream.UpdatedAt,
+			Parents:       stream.Parent,
+			Children:      stream.Children,
+		}
+		queue = append(queue, stream.Parent...)
+		queue = append(queue, stream.Children...)
+	}
+
+	return sortHistory(commits), nil
+}
+
+// sortHistory orders commits newest first, holding every commit back until the
+// commits that name it as a parent have been listed.
+func sortHistory(commits map[string]*StreamCommit) []StreamCommit {
+	pending := map[string]int{}
+	for _, c := range commits {
+		for _, parent := range c.Parents {
+			if _, ok := commits[parent]; ok {
+				pending[parent]++
+			}
+		}
+	}
+
+	ready := []*StreamCommit{}
+	for id, c := range commits {
+		if pending[id] == 0 {
+			ready = append(ready, c)
+		}
+	}
+
+	log := make([]StreamCommit, 0, len(commits))
+	for len(commits) > len(log) {
+		if len(ready) == 0 {
+			// A cycle in the lineage, break it at its newest commit.
+			var newest *StreamCommit
+			for id, c := range commits {
+				if pending[id] > 0 && (newest == nil || newer(c, newest)) {
+					newest = c
+				}
+			}
+			pending[newest.StreamID] = 0
+			ready = append(ready, newest)
+		}
+
+		sort.Slice(ready, func(i, j int) bool { return newer(ready[i], ready[j]) })
+		next := ready[0]
+		ready = ready[1:]
+		log = append(log, *next)
+
+		for _, parent := range next.Parents {
+			if c, ok := commits[parent]; ok && pending[parent] > 0 {
+				pending[parent]--
+				if pending[parent] == 0 {
+					ready = append(ready, c)
+				}
+			}
+		}
+	}
+
+	return log
+}
+
+// newer reports whether commit a was created after commit b. Commits without a
+// creation date are the oldest, and ties are broken by stream ID.
+func newer(a *StreamCommit, b *StreamCommit) bool {
+	switch {
+	case a.CreatedAt != nil && b.CreatedAt != nil && !a.CreatedAt.Equal(*b.CreatedAt):
+		return a.CreatedAt.After(*b.CreatedAt)
+	case a.CreatedAt != nil && b.CreatedAt == nil:
+		return true
+	case a.CreatedAt == nil && b.CreatedAt != nil:
+		return false
+	}
+	return a.StreamID > b.StreamID
+}
@@ -0,0 +1,102 @@
+package gospeckle
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSortHistory(t *testing.T) {
+	at := func(minute int) *time.Time {
+		d := time.Date(2019, 5, 1, 12, minute, 0, 0, time.UTC)
+		return &d
+	}
+
+	tests := []struct {
+		name    string
+		commits []StreamCommit
+		want    []string
+	}{
+		{
+			name: "linear",
+			commits: []StreamCommit{
+				{StreamID: "a", CreatedAt: at(1)},
+				{StreamID: "b", CreatedAt: at(2), Parents: []string{"a"}},
+				{StreamID: "c", CreatedAt: at(3), Parents: []string{"b"}},
+			},
+			want: []string{"c", "b", "a"},
+		},
+		{
+			name: "branches by date",
+			commits: []StreamCommit{
+				{StreamID: "root", CreatedAt: at(1)},
+				{StreamID: "x", CreatedAt: at(2), Parents: []string{"root"}},
+				{StreamID: "y", CreatedAt: at(4), Parents: []string{"root"}},
+				{StreamID: "x2", CreatedAt: at(3), Parents: []string{"x"}},
+			},
+			want: []string{"y", "x2", "x", "root"},
+		},
+		{
+			name: "lineage before dates",
+			commits: []StreamCommit{
+				{StreamID: "a", CreatedAt: at(5)},
+				{StreamID: "b", CreatedAt: at(1), Parents: []string{"a"}},
+			},
+			want: []string{"b", "a"},
+		},
+		{
+			name: "merge",
+			commits: []StreamCommit{
+				{StreamID: "base", CreatedAt: at(1)},
+				{StreamID: "left", CreatedAt: at(2), Parents: []string{"base"}},
+				{StreamID: "right", CreatedAt: at(3), Parents: []string{"base"}},
+				{StreamID: "merge", CreatedAt: at(4), Parents: []string{"left", "right"}},
+			},
+			want: []string{"merge", "right", "left", "base"},
+		},
+		{
+			name: "parents outside the history",
+			commits: []StreamCommit{
+				{StreamID: "a", CreatedAt: at(1), Parents: []string{"gone"}},
+				{StreamID: "b", CreatedAt: at(2), Parents: []string{"a", "elsewhere"}},
+			},
+			want: []string{"b", "a"},
+		},
+		{
+			name: "without dates",
+			commits: []StreamCommit{
+				{StreamID: "a"},
+				{StreamID: "c"},
+				{StreamID: "b", CreatedAt: at(1)},
+			},
+			want: []string{"b", "c", "a"},
+		},
+		{
+			name: "cycle",
+			commits: []StreamCommit{
+				{StreamID: "a", CreatedAt: at(1), Parents: []string{"b"}},
+				{StreamID: "b", CreatedAt: at(2), Parents: []string{"a"}},
+				{StreamID: "c", CreatedAt: at(3), Parents: []string{"b"}},
+			},
+			want: []string{"c", "b", "a"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			commits := map[string]*StreamCommit{}
+			for i := range test.commits {
+				commits[test.commits[i].StreamID] = &test.commits[i]
+			}
+
+			var got []string
+			for _, c := range sortHistory(commits) {
+				got = append(got, c.StreamID)
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
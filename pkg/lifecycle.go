@@ -0,0 +1,125 @@
+package gospeckle
+
+import (
+	"context"
+	"time"
+)
+
+// lifecycleTimeout bounds the requests made to mark a client offline or delete it,
+// which run after the session's context may already be done.
+const lifecycleTimeout = 10 * time.Second
+
+// ClientLifecycle lets a Session own the APIClient it connects as. If the session
+// has no client ID, a client is created on Connect with the given document metadata;
+// otherwise the existing client is reused. The client is marked online every time the
+// session connects and offline when it disconnects or is closed.
+type ClientLifecycle struct {
+	Role             string
+	DocumentName     string
+	DocumentType     string
+	DocumentLocation string
+	DocumentGUID     string
+	// Ephemeral clients are deleted when the session is closed.
+	Ephemeral bool
+	// OnError is called when the client can't be updated or deleted. Those errors don't
+	// interrupt the session.
+	OnError func(err error)
+}
+
+// acquireClient creates the session's client if it doesn't have one yet.
+func (s *Session) acquireClient(ctx context.Context) error {
+	l := s.opts.Lifecycle
+	if l == nil || s.clientID != "" {
+		return nil
+	}
+
+	online := false
+	client, _, err := s.client.APIClient.Create(ctx, APIClientRequest{
+		Role:             l.Role,
+		DocumentName:     l.DocumentName,
+		DocumentType:     l.DocumentType,
+		DocumentLocation: l.DocumentLocation,
+		DocumentGUID:     l.DocumentGUID,
+		StreamID:         s.streamID,
+		Online:           &online,
+	})
+	if err != nil {
+		return err
+	}
+
+	s.clientID = client.ID
+	return nil
+}
+
+// setOnline queues an update of the online status of the session's client. Updates
+// are sent in order by updateStatus, so that a slow server doesn't hold up the read
+// loop, and an update still queued is replaced by a newer one. It is only called
+// from the goroutine running the session.
+func (s *Session) setOnline(online bool) {
+	if s.opts.Lifecycle == nil || s.statusUpdates == nil {
+		return
+	}
+
+	select {
+	case <-s.statusUpdates:
+	default:
+	}
+	s.statusUpdates <- online
+}
+
+// updateStatus sends the online status updates queued by setOnline until updates
+// is closed.
+func (s *Session) updateStatus(updates <-chan bool, done chan<- struct{}) {
+	defer close(done)
+
+	for online := range updates {
+		s.updateOnline(online)
+	}
+}
+
+// updateOnline updates the online status of the session's client.
+func (s *Session) updateOnline(online bool) {
+	l := s.opts.Lifecycle
+	if l == nil || s.clientID == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), lifecycleTimeout)
+	defer cancel()
+
+	_, err := s.client.APIClient.Update(ctx, s.clientID, APIClientRequest{Online: &online})
+	if err != nil && l.OnError != nil {
+		l.OnError(err)
+	}
+}
+
+// releaseClient releases the session's client once, after the status updates still
+// queued were sent, and returns the error of doing so.
+func (s *Session) releaseClient() error {
+	s.releaseOnce.Do(func() {
+		if s.statusDone != nil {
+			<-s.statusDone
+		}
+		s.releaseErr = s.release()
+	})
+	return s.releaseErr
+}
+
+// release marks the session's client offline, deleting it if it is ephemeral.
+func (s *Session) release() error {
+	l := s.opts.Lifecycle
+	if l == nil || s.clientID == "" {
+		return nil
+	}
+
+	if !l.Ephemeral {
+		s.updateOnline(false)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), lifecycleTimeout)
+	defer cancel()
+
+	_, err := s.client.APIClient.Delete(ctx, s.clientID)
+	return err
+}
@@ -0,0 +1,394 @@
+package gospeckle
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// Kinds of resources in conflict in a StreamMerge.
+const (
+	ConflictObject = "object"
+	ConflictLayer  = "layer"
+)
+
+// ErrMergeConflicts is returned by StreamService.Merge when the streams are in
+// conflict and the merge isn't forced.
+var ErrMergeConflicts = errors.New("the streams are in conflict")
+
+// StreamMerge is the result of a three-way merge of two streams that diverged from
+// a common ancestor. Objects are keyed by application ID, or by ID when they have
+// none. A change made on one side only is taken, and when both sides changed an
+// object or a layer differently, the first stream's version is kept and the
+// conflict is recorded for manual resolution.
+type StreamMerge struct {
+	Base string `json:"base"`
+	A    string `json:"a"`
+	B    string `json:"b"`
+	// Stream is the stream created with the merge, set by StreamService.Merge.
+	Stream Stream `json:"-"`
+	// Objects and Layers are the content of the merged stream.
+	Objects []json.RawMessage `json:"-"`
+	Layers  []Layer           `json:"-"`
+	// FromA and FromB count the changes taken from each stream.
+	FromA     int             `json:"fromA"`
+	FromB     int             `json:"fromB"`
+	Conflicts []MergeConflict `json:"conflicts"`
+}
+
+// MergeConflict is an object or a layer both sides of a merge changed differently.
+// Base, A and B are its versions in each stream, null where it doesn't exist.
+type MergeConflict struct {
+	Kind string          `json:"kind"`
+	Key  string          `json:"key"`
+	Base json.RawMessage `json:"base"`
+	A    json.RawMessage `json:"a"`
+	B    json.RawMessage `json:"b"`
+	// Added lists, for an object without an application ID that both sides removed,
+	// the keys of the objects of the same type either side added. Changing such an
+	// object gives it a new ID, so they may be changed versions of it.
+	Added []string `json:"added,omitempty"`
+}
+
+// Merge merges two streams that were cloned from a common ancestor into a new
+// stream, named after the first one, whose parents are both streams. The new
+// stream is also added to the children of both, so that it shows in their history.
+// When there are conflicts, nothing is created and the merge is returned with
+// ErrMergeConflicts, unless force is set: the merged stream then holds the first
+// stream's version of what's in conflict. If the merged stream was created but
+// couldn't be added to the children of a stream, the merge is returned with the
+// error.
+func (s *StreamService) Merge(ctx context.Context, streamA string, streamB string, message string, force bool) (*StreamMerge, error) {
+	base, err := s.MergeBase(ctx, streamA, streamB)
+	if err != nil {
+		return nil, err
+	}
+
+	archives := make([]*StreamArchive, 3)
+	for i, id := range []string{base, streamA, streamB} {
+		archives[i], err = s.snapshot(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	merge, err := MergeStreams(archives[0], archives[1], archives[2])
+	if err != nil {
+		return nil, err
+	}
+	if len(merge.Conflicts) > 0 && !force {
+		return merge, ErrMergeConflicts
+	}
+
+	a := archives[1].Stream
+	request := a.Request()
+	request.Objects = make([]*Object, len(merge.Objects))
+	for i, data := range merge.Objects {
+		request.Objects[i] = new(Object)
+		err = json.Unmarshal(data, request.Objects[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	request.Layers = make([]*Layer, len(merge.Layers))
+	for i := range merge.Layers {
+		request.Layers[i] = &merge.Layers[i]
+	}
+	request.CommitMessage = message
+	request.Parent = []string{streamA, streamB}
+	request.Children = nil
+
+	merge.Stream, _, err = s.Create(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, parent := range archives[1:] {
+		children := append(append([]string{}, parent.Stream.Children...), merge.Stream.StreamID)
+		_, err = s.Update(ctx, parent.Stream.StreamID, StreamRequest{Children: children})
+		if err != nil {
+			return merge, fmt.Errorf("adding merged stream %v to the children of %v: %v", merge.Stream.StreamID, parent.Stream.StreamID, err)
+		}
+	}
+
+	return merge, nil
+}
+
+// MergeBase returns the closest common ancestor of two streams in their parents
+// lineage, a stream itself being its own ancestor.
+func (s *StreamService) MergeBase(ctx context.Context, streamA string, streamB string) (string, error) {
+	ancestorsA, err := s.ancestors(ctx, streamA)
+	if err != nil {
+		return "", err
+	}
+	ancestorsB, err := s.ancestors(ctx, streamB)
+	if err != nil {
+		return "", err
+	}
+
+	base, distance := "", -1
+	for id, depthA := range ancestorsA {
+		depthB, ok := ancestorsB[id]
+		if !ok {
+			continue
+		}
+		if d := depthA + depthB; distance < 0 || d < distance || (d == distance && id < base) {
+			base, distance = id, d
+		}
+	}
+
+	if base == "" {
+		return "", fmt.Errorf("streams %v and %v have no common ancestor", streamA, streamB)
+	}
+	return base, nil
+}
+
+// ancestors returns the streams of a stream's parents lineage with their distance
+// to it. Parents that were deleted or aren't shared with the user are ancestors
+// too, but their own parents can't be followed.
+func (s *StreamService) ancestors(ctx context.Context, streamID string) (map[string]int, error) {
+	ancestors := map[string]int{streamID: 0}
+	queue := []string{streamID}
+
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+
+		stream, _, err := s.Get(ctx, id)
+		if err != nil {
+			if id != streamID && isMissing(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		for _, parent := range stream.Parent {
+			if _, ok := ancestors[parent]; !ok {
+				ancestors[parent] = ancestors[id] + 1
+				queue = append(queue, parent)
+			}
+		}
+	}
+
+	return ancestors, nil
+}
+
+// mergeSide is the content of one of the streams of a merge, by key.
+type mergeSide struct {
+	objects map[string]*diffObject
+	raw     map[string]json.RawMessage
+	order   []string
+}
+
+func newMergeSide(archive *StreamArchive) (*mergeSide, error) {
+	objects, err := diffObjects(archive.Objects)
+	if err != nil {
+		return nil, fmt.Errorf("stream %v: %v", archive.Stream.StreamID, err)
+	}
+
+	raw := map[string]json.RawMessage{}
+	for _, data := range archive.Objects {
+		var keys struct {
+			ID string `json:"_id"`
+		}
+		json.Unmarshal(data, &keys)
+		if _, ok := raw[keys.ID]; !ok {
+			raw[keys.ID] = data
+		}
+	}
+
+	side := &mergeSide{objects: map[string]*diffObject{}, raw: map[string]json.RawMessage{}}
+	for _, o := range objects {
+		// Clones share the objects they didn't change, so without an application ID
+		// an object is the same on each side if it has the same ID. Its hash changes
+		// with its content and would tell a changed object from its base version.
+		key := MatchApplicationID + ":" + o.ApplicationID
+		if o.ApplicationID == "" {
+			key = MatchID + ":" + o.ID
+		}
+
+		// Objects sharing a key are told apart by their rank.
+		for n, first := 2, key; side.objects[key] != nil; n++ {
+			key = fmt.Sprintf("%v#%v", first, n)
+		}
+
+		side.objects[key] = o
+		side.raw[key] = raw[o.ID]
+		side.order = append(side.order, key)
+	}
+
+	return side, nil
+}
+
+// MergeStreams merges the objects and layers of two archived streams changed from
+// a common base.
+func MergeStreams(base *StreamArchive, a *StreamArchive, b *StreamArchive) (*StreamMerge, error) {
+	merge := &StreamMerge{Base: base.Stream.StreamID, A: a.Stream.StreamID, B: b.Stream.StreamID}
+
+	sides := make([]*mergeSide, 3)
+	for i, archive := range []*StreamArchive{base, a, b} {
+		var err error
+		sides[i], err = newMergeSide(archive)
+		if err != nil {
+			return nil, err
+		}
+	}
+	o, oa, ob := sides[0], sides[1], sides[2]
+
+	for _, key := range mergeKeys(oa.order, ob.order) {
+		fromB, conflict := merge.pick(sameObject(o.objects[key], oa.objects[key]), sameObject(o.objects[key], ob.objects[key]), sameObject(oa.objects[key], ob.objects[key]))
+		if conflict {
+			merge.Conflicts = append(merge.Conflicts, MergeConflict{Kind: ConflictObject, Key: key, Base: nullable(o.raw[key]), A: nullable(oa.raw[key]), B: nullable(ob.raw[key])})
+		}
+
+		data := oa.raw[key]
+		if fromB {
+			data = ob.raw[key]
+		}
+		if data != nil {
+			merge.Objects = append(merge.Objects, data)
+		}
+	}
+
+	merge.Conflicts = append(merge.Conflicts, removedOnBothSides(o, oa, ob)...)
+
+	layers := make([]map[string]Layer, 3)
+	orders := make([][]string, 3)
+	for i, archive := range []*StreamArchive{base, a, b} {
+		layers[i] = map[string]Layer{}
+		for _, layer := range archive.Stream.Layers {
+			key := layer.GUID
+			if key == "" {
+				key = "name:" + layer.Name
+			}
+			layers[i][key] = layer
+			orders[i] = append(orders[i], key)
+		}
+	}
+
+	for _, key := range mergeKeys(orders[1], orders[2]) {
+		lo, okO := layers[0][key]
+		la, okA := layers[1][key]
+		lb, okB := layers[2][key]
+
+		fromB, conflict := merge.pick(sameLayer(lo, okO, la, okA), sameLayer(lo, okO, lb, okB), sameLayer(la, okA, lb, okB))
+		if conflict {
+			merge.Conflicts = append(merge.Conflicts, MergeConflict{Kind: ConflictLayer, Key: key, Base: layerJSON(lo, okO), A: layerJSON(la, okA), B: layerJSON(lb, okB)})
+		}
+
+		switch {
+		case fromB && okB:
+			merge.Layers = append(merge.Layers, lb)
+		case !fromB && okA:
+			merge.Layers = append(merge.Layers, la)
+		}
+	}
+
+	return merge, nil
+}
+
+// pick chooses the side of a merge to take something from, given whether each
+// side left it as it was in the base and whether both sides agree on it. It reports
+// whether the second side is taken, and whether both sides are in conflict, in
+// which case the first side is kept.
+func (m *StreamMerge) pick(unchangedA bool, unchangedB bool, same bool) (fromB bool, conflict bool) {
+	switch {
+	case unchangedA && unchangedB, same:
+		return false, false
+	case unchangedA:
+		m.FromB++
+		return true, false
+	case unchangedB:
+		m.FromA++
+		return false, false
+	}
+	return false, true
+}
+
+// removedOnBothSides reports a conflict for every object without an application ID
+// of the base that both sides removed while either side added objects of the same
+// type. Changing such an object gives it a new ID, so the added objects may be
+// versions of it that both sides changed.
+func removedOnBothSides(o *mergeSide, oa *mergeSide, ob *mergeSide) []MergeConflict {
+	var conflicts []MergeConflict
+
+	for _, key := range o.order {
+		base := o.objects[key]
+		if base.ApplicationID != "" || oa.objects[key] != nil || ob.objects[key] != nil {
+			continue
+		}
+
+		var added []string
+		for _, k := range mergeKeys(oa.order, ob.order) {
+			other := oa.objects[k]
+			if other == nil {
+				other = ob.objects[k]
+			}
+			if o.objects[k] == nil && other.Type == base.Type {
+				added = append(added, k)
+			}
+		}
+		if len(added) == 0 {
+			continue
+		}
+
+		conflicts = append(conflicts, MergeConflict{
+			Kind:  ConflictObject,
+			Key:   key,
+			Base:  o.raw[key],
+			A:     nullable(nil),
+			B:     nullable(nil),
+			Added: added,
+		})
+	}
+
+	return conflicts
+}
+
+// mergeKeys lists the keys of both sides of a merge, those of the first side first.
+func mergeKeys(a []string, b []string) []string {
+	keys := append([]string{}, a...)
+	seen := map[string]bool{}
+	for _, key := range a {
+		seen[key] = true
+	}
+	for _, key := range b {
+		if !seen[key] {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// sameObject reports whether two versions of an object have the same content, a
+// nil object being one that doesn't exist.
+func sameObject(a *diffObject, b *diffObject) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.GeometryHash == b.GeometryHash && len(DiffJSON(a.fields, b.fields)) == 0
+}
+
+func sameLayer(a Layer, okA bool, b Layer, okB bool) bool {
+	if !okA || !okB {
+		return okA == okB
+	}
+	return reflect.DeepEqual(layerFields(a), layerFields(b))
+}
+
+func layerJSON(layer Layer, ok bool) json.RawMessage {
+	if !ok {
+		return json.RawMessage("null")
+	}
+	data, _ := json.Marshal(layer)
+	return data
+}
+
+func nullable(data json.RawMessage) json.RawMessage {
+	if data == nil {
+		return json.RawMessage("null")
+	}
+	return data
+}
@@ -0,0 +1,186 @@
+package gospeckle
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestStreamMergePick(t *testing.T) {
+	tests := []struct {
+		name       string
+		unchangedA bool
+		unchangedB bool
+		same       bool
+		fromB      bool
+		conflict   bool
+		fromACount int
+		fromBCount int
+	}{
+		{name: "unchanged", unchangedA: true, unchangedB: true, same: true},
+		{name: "changed on A", unchangedB: true, fromACount: 1},
+		{name: "changed on B", unchangedA: true, fromB: true, fromBCount: 1},
+		{name: "same change on both", same: true},
+		{name: "different changes", conflict: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := &StreamMerge{}
+			fromB, conflict := m.pick(test.unchangedA, test.unchangedB, test.same)
+
+			if fromB != test.fromB || conflict != test.conflict {
+				t.Errorf("got fromB %v, conflict %v, want %v, %v", fromB, conflict, test.fromB, test.conflict)
+			}
+			if m.FromA != test.fromACount || m.FromB != test.fromBCount {
+				t.Errorf("got FromA %v, FromB %v, want %v, %v", m.FromA, m.FromB, test.fromACount, test.fromBCount)
+			}
+		})
+	}
+}
+
+func TestMergeStreams(t *testing.T) {
+	archive := func(streamID string, layers []Layer, objects ...string) *StreamArchive {
+		a := &StreamArchive{Stream: Stream{StreamID: streamID, Layers: layers}}
+		for _, o := range objects {
+			a.Objects = append(a.Objects, json.RawMessage(o))
+		}
+		return a
+	}
+
+	const (
+		wall     = `{"_id": "o1", "applicationId": "wall", "type": "Brep", "properties": {"height": 3}}`
+		wallA    = `{"_id": "o2", "applicationId": "wall", "type": "Brep", "properties": {"height": 4}}`
+		wallB    = `{"_id": "o3", "applicationId": "wall", "type": "Brep", "properties": {"height": 5}}`
+		point    = `{"_id": "p1", "type": "Point", "value": [0, 0, 0]}`
+		pointA   = `{"_id": "p2", "type": "Point", "value": [1, 0, 0]}`
+		pointB   = `{"_id": "p3", "type": "Point", "value": [0, 1, 0]}`
+		line     = `{"_id": "l1", "type": "Line"}`
+		polyline = `{"_id": "s1", "hash": "h", "type": "Polyline"}`
+	)
+
+	tests := []struct {
+		name      string
+		base      *StreamArchive
+		a         *StreamArchive
+		b         *StreamArchive
+		objects   []string
+		layers    []string
+		fromA     int
+		fromB     int
+		conflicts []MergeConflict
+	}{
+		{
+			name:    "changed on one side",
+			base:    archive("o", nil, wall, point),
+			a:       archive("a", nil, wall, point),
+			b:       archive("b", nil, wallB, point),
+			objects: []string{wallB, point},
+			fromB:   1,
+		},
+		{
+			name:    "added and removed",
+			base:    archive("o", nil, wall, point),
+			a:       archive("a", nil, wall, point, line),
+			b:       archive("b", nil, wall),
+			objects: []string{wall, line},
+			fromA:   1,
+			fromB:   1,
+		},
+		{
+			name:    "objects without application ID are keyed by ID",
+			base:    archive("o", nil, point, polyline),
+			a:       archive("a", nil, pointA, polyline),
+			b:       archive("b", nil, point, polyline),
+			objects: []string{pointA, polyline},
+			fromA:   2,
+		},
+		{
+			name:    "conflict",
+			base:    archive("o", nil, wall),
+			a:       archive("a", nil, wallA),
+			b:       archive("b", nil, wallB),
+			objects: []string{wallA},
+			conflicts: []MergeConflict{
+				{Kind: ConflictObject, Key: "applicationId:wall", Base: json.RawMessage(wall), A: json.RawMessage(wallA), B: json.RawMessage(wallB)},
+			},
+		},
+		{
+			name:    "removed on both sides with additions",
+			base:    archive("o", nil, point, line),
+			a:       archive("a", nil, pointA, line),
+			b:       archive("b", nil, pointB, line),
+			objects: []string{pointA, line, pointB},
+			fromA:   1,
+			fromB:   1,
+			conflicts: []MergeConflict{
+				{Kind: ConflictObject, Key: "_id:p1", Base: json.RawMessage(point), A: json.RawMessage("null"), B: json.RawMessage("null"), Added: []string{"_id:p2", "_id:p3"}},
+			},
+		},
+		{
+			name:    "removed on both sides",
+			base:    archive("o", nil, point, line),
+			a:       archive("a", nil, line),
+			b:       archive("b", nil, line),
+			objects: []string{line},
+		},
+		{
+			name:   "layers",
+			base:   archive("o", []Layer{{GUID: "g1", Name: "one"}, {GUID: "g2", Name: "two"}}),
+			a:      archive("a", []Layer{{GUID: "g1", Name: "uno"}, {GUID: "g2", Name: "two"}}),
+			b:      archive("b", []Layer{{GUID: "g1", Name: "one"}, {Name: "three"}}),
+			layers: []string{"uno", "three"},
+			fromA:  1,
+			fromB:  2,
+		},
+		{
+			name:   "layer conflict",
+			base:   archive("o", []Layer{{GUID: "g1", Name: "one"}}),
+			a:      archive("a", []Layer{{GUID: "g1", Name: "uno"}}),
+			b:      archive("b", []Layer{{GUID: "g1", Name: "eins"}}),
+			layers: []string{"uno"},
+			conflicts: []MergeConflict{
+				{
+					Kind: ConflictLayer,
+					Key:  "g1",
+					Base: layerJSON(Layer{GUID: "g1", Name: "one"}, true),
+					A:    layerJSON(Layer{GUID: "g1", Name: "uno"}, true),
+					B:    layerJSON(Layer{GUID: "g1", Name: "eins"}, true),
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			merge, err := MergeStreams(test.base, test.a, test.b)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var objects []string
+			for _, data := range merge.Objects {
+				objects = append(objects, string(data))
+			}
+			if !reflect.DeepEqual(objects, test.objects) {
+				t.Errorf("objects: got %v, want %v", objects, test.objects)
+			}
+
+			var layers []string
+			for _, layer := range merge.Layers {
+				layers = append(layers, layer.Name)
+			}
+			if !reflect.DeepEqual(layers, test.layers) {
+				t.Errorf("layers: got %v, want %v", layers, test.layers)
+			}
+
+			if merge.FromA != test.fromA || merge.FromB != test.fromB {
+				t.Errorf("got FromA %v, FromB %v, want %v, %v", merge.FromA, merge.FromB, test.fromA, test.fromB)
+			}
+
+			if !reflect.DeepEqual(merge.Conflicts, test.conflicts) {
+				t.Errorf("conflicts: got %+v, want %+v", merge.Conflicts, test.conflicts)
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package gospeckle
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// subscriptionBuffer is the number of events buffered for each subscription. Events
+// are dropped for subscribers that fall further behind, so that one slow subscriber
+// doesn't stall the connection shared by every stream.
+const subscriptionBuffer = 64
+
+// ErrMultiplexerClosed is returned when subscribing through a closed Multiplexer.
+var ErrMultiplexerClosed = errors.New("multiplexer is closed")
+
+// Multiplexer subscribes to any number of streams over a single websocket Session. The
+// session connects without a stream; streams are joined when their first subscriber
+// arrives and left when their last one goes, and every subscribed stream is joined
+// again after the session reconnects. Events are fanned out by stream ID; events whose frames
+// carry no stream ID aren't delivered to subscriptions, and can be handled with the
+// handlers of the underlying Session.
+type Multiplexer struct {
+	session *Session
+
+	// joinMu serialises joining and leaving streams. It is held while sending the
+	// messages that do so, unlike mu, which routing events waits on.
+	joinMu sync.Mutex
+	mu     sync.Mutex
+	subs   map[string]map[*Subscription]struct{}
+	closed bool
+}
+
+// Subscription receives the events of one stream from a Multiplexer.
+type Subscription struct {
+	mux      *Multiplexer
+	streamID string
+	events   chan Event
+
+	mu      sync.Mutex
+	closed  bool
+	dropped int
+}
+
+// NewMultiplexer returns a Multiplexer for a client ID. opts are used for the
+// underlying Session. The multiplexer does not dial the server until Connect is called.
+func (c *Client) NewMultiplexer(clientID string, opts *SessionOptions) *Multiplexer {
+	m := &Multiplexer{
+		subs: map[string]map[*Subscription]struct{}{},
+	}
+
+	var sessionOpts SessionOptions
+	if opts != nil {
+		sessionOpts = *opts
+	}
+
+	onStateChange := sessionOpts.OnStateChange
+	sessionOpts.OnStateChange = func(state SessionState, err error) {
+		if state == SessionConnected {
+			m.rejoin()
+		}
+		if onStateChange != nil {
+			onStateChange(state, err)
+		}
+	}
+
+	m.session = c.NewSession(clientID, "", &sessionOpts)
+	m.session.taps = append(m.session.taps, m.route)
+
+	return m
+}
+
+// Session returns the underlying session, which can be used to register handlers for
+// events that aren't tied to a stream or to send messages.
+func (m *Multiplexer) Session() *Session {
+	return m.session
+}
+
+// Connect dials the server. See Session.Connect.
+func (m *Multiplexer) Connect(ctx context.Context) error {
+	return m.session.Connect(ctx)
+}
+
+// Close closes every subscription and the underlying session.
+func (m *Multiplexer) Close() error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil
+	}
+	m.closed = true
+
+	subs := m.subs
+	m.subs = map[string]map[*Subscription]struct{}{}
+	m.mu.Unlock()
+
+	for _, streamSubs := range subs {
+		for sub := range streamSubs {
+			sub.close()
+		}
+	}
+
+	return m.session.Close()
+}
+
+// Streams returns the IDs of the streams that have at least one subscriber.
+func (m *Multiplexer) Streams() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	streams := make([]string, 0, len(m.subs))
+	for streamID := range m.subs {
+		streams = append(streams, streamID)
+	}
+	return streams
+}
+
+// Subscribe returns a subscription to a stream's events, joining the stream if it is
+// its first subscriber. While the session isn't connected, the stream is joined once
+// it connects.
+func (m *Multiplexer) Subscribe(streamID string) (*Subscription, error) {
+	sub := &Subscription{
+		mux:      m,
+		streamID: streamID,
+		events:   make(chan Event, subscriptionBuffer),
+	}
+
+	m.joinMu.Lock()
+	defer m.joinMu.Unlock()
+
+	m.mu.Lock()
+	closed := m.closed
+	_, joined := m.subs[streamID]
+	m.mu.Unlock()
+
+	if closed {
+		return nil, ErrMultiplexerClosed
+	}
+
+	if !joined {
+		// The stream is only registered once it has been joined, or will be when the
+		// session connects, so a failed join doesn't leave a stream behind that
+		// would be joined again on reconnect.
+		err := m.session.Send(WebsocketMessage{EventName: EventJoinStream, StreamID: streamID})
+		if err != nil && err != ErrSessionNotConnected {
+			return nil, err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return nil, ErrMultiplexerClosed
+	}
+
+	streamSubs, ok := m.subs[streamID]
+	if !ok {
+		streamSubs = map[*Subscription]struct{}{}
+		m.subs[streamID] = streamSubs
+	}
+	streamSubs[sub] = struct{}{}
+
+	return sub, nil
+}
+
+// unsubscribe removes a subscription, leaving its stream if it was the last one.
+func (m *Multiplexer) unsubscribe(sub *Subscription) error {
+	m.joinMu.Lock()
+	defer m.joinMu.Unlock()
+
+	m.mu.Lock()
+	streamSubs, ok := m.subs[sub.streamID]
+	if ok {
+		_, ok = streamSubs[sub]
+	}
+	if ok {
+		delete(streamSubs, sub)
+		ok = len(streamSubs) == 0
+	}
+	if ok {
+		delete(m.subs, sub.streamID)
+	}
+	m.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	err := m.session.Send(WebsocketMessage{EventName: EventLeaveStream, StreamID: sub.streamID})
+	if err == ErrSessionNotConnected {
+		// The stream won't be joined again when the session reconnects.
+		return nil
+	}
+	return err
+}
+
+// rejoin joins every subscribed stream once the session has connected, again after
+// it reconnects.
+func (m *Multiplexer) rejoin() {
+	m.joinMu.Lock()
+	defer m.joinMu.Unlock()
+
+	for _, streamID := range m.Streams() {
+		m.session.Send(WebsocketMessage{EventName: EventJoinStream, StreamID: streamID})
+	}
+}
+
+// route delivers an event to the subscriptions of its stream. Events without a
+// stream ID are left to the session's handlers.
+func (m *Multiplexer) route(ctx context.Context, e Event) {
+	streamID := e.Header().StreamID
+	if streamID == "" {
+		return
+	}
+
+	m.mu.Lock()
+	var subs []*Subscription
+	for sub := range m.subs[streamID] {
+		subs = append(subs, sub)
+	}
+	m.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.deliver(e)
+	}
+}
+
+// StreamID returns the ID of the stream the subscription receives events for.
+func (s *Subscription) StreamID() string {
+	return s.streamID
+}
+
+// Events returns the channel the stream's events are delivered on. It is closed when
+// the subscription or its multiplexer is closed.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Dropped returns the number of events dropped because the subscriber didn't keep up.
+func (s *Subscription) Dropped() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// Close stops the subscription, leaving the stream if it was its last subscriber.
+func (s *Subscription) Close() error {
+	err := s.mux.unsubscribe(s)
+	s.close()
+	return err
+}
+
+func (s *Subscription) deliver(e Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	select {
+	case s.events <- e:
+	default:
+		s.dropped++
+	}
+}
+
+func (s *Subscription) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.events)
+}
@@ -2,8 +2,9 @@ package gospeckle
 
 import (
 	"context"
-	"fmt"
+	"encoding/json"
 	"net/http"
+	"net/url"
 )
 
 const objectBasePath = "objects"
@@ -68,7 +69,9 @@ func (s *ObjectService) Search(ctx context.Context, query string, ids []string)
 	return *resource, resp, nil
 }
 
-// Get retrieves a specific object indexed by it's ID
+// Get retrieves a specific object indexed by it's ID. If the client has an ObjectStore
+// holding the object, it is returned without contacting the server, with a response
+// whose X-Gospeckle-Object-Store header is hit.
 func (s *ObjectService) Get(ctx context.Context, id string) (Object, *http.Response, error) {
 	resource := new(Object)
 
@@ -77,11 +80,29 @@ func (s *ObjectService) Get(ctx context.Context, id string) (Object, *http.Respo
 		return *resource, nil, err
 	}
 
-	resp, _, err := s.client.Do(ctx, req, resource, false)
+	store := s.client.scopedObjectStore()
+	if store != nil {
+		if o, ok := store.GetByID(id); ok {
+			return o, storedResponse(req), nil
+		}
+	}
+
+	raw := new(json.RawMessage)
+	resp, _, err := s.client.Do(ctx, req, raw, false)
 	if err != nil {
 		return *resource, nil, err
 	}
 
+	err = json.Unmarshal(*raw, resource)
+	if err != nil {
+		return *resource, resp, err
+	}
+
+	if store != nil {
+		// The store is only a cache, failing to write to it doesn't fail the request.
+		store.put(*raw)
+	}
+
 	return *resource, resp, nil
 }
 
@@ -104,6 +125,8 @@ func (s *ObjectService) Create(ctx context.Context, new ObjectRequest) (Object,
 
 // Update will update object indexed by it's ID.
 func (s *ObjectService) Update(ctx context.Context, id string, update ObjectRequest) (*http.Response, error) {
+	s.forget(id)
+
 	req, err := s.client.NewRequest(ctx, http.MethodPut, objectBasePath+"/"+id, update)
 	if err != nil {
 		return nil, err
@@ -119,6 +142,8 @@ func (s *ObjectService) Update(ctx context.Context, id string, update ObjectRequ
 
 // Delete deletes a specific object indexed by it's ID
 func (s *ObjectService) Delete(ctx context.Context, id string) (*http.Response, error) {
+	s.forget(id)
+
 	req, err := s.client.NewRequest(ctx, http.MethodDelete, objectBasePath+"/"+id, nil)
 	if err != nil {
 		return nil, err
@@ -158,7 +183,7 @@ func (s *ObjectService) GetComments(ctx context.Context, id string) ([]Comment,
 		return *resource, nil, err
 	}
 
-	resp, _, err := s.client.Do(ctx, req, resource, false)
+	resp, _, err := s.client.Do(ctx, req, resource, true)
 	if err != nil {
 		return *resource, nil, err
 	}
@@ -166,30 +191,166 @@ func (s *ObjectService) GetComments(ctx context.Context, id string) ([]Comment,
 	return *resource, resp, nil
 }
 
-// GetBulk will search for objects in a given range of IDs using a query.
+// GetBulk will search for objects in a given range of IDs using a query. Without a
+// query, objects held by the client's ObjectStore are taken from it and only the
+// others are requested. If none had to be, the response's X-Gospeckle-Object-Store
+// header is hit. Queries can select a subset of the objects' fields, so they bypass
+// the store.
 func (s *ObjectService) GetBulk(ctx context.Context, idList ObjectGetBulkIDs, query ObjectGetBulkQuery) ([]Object, *http.Response, error) {
-	resource := []Object{} // new(Object)
-	queryPath := "?"
+	resource := []Object{}
 
-	for k, v := range query {
-		queryPath += k + "=" + v + "&"
+	raw, resp, err := s.GetBulkRaw(ctx, idList, query)
+	if err != nil {
+		return resource, resp, err
+	}
+
+	for _, data := range raw {
+		var o Object
+		err = json.Unmarshal(data, &o)
+		if err != nil {
+			return resource, resp, err
+		}
+		resource = append(resource, o)
 	}
 
-	if string(queryPath[len(queryPath)-1]) == "&" {
-		queryPath = queryPath[len(queryPath)-1:]
+	return resource, resp, nil
+}
+
+// GetBulkRaw is GetBulk, returning the objects as the server sent them, with the
+// fields Object doesn't have, such as the geometry of most object types.
+func (s *ObjectService) GetBulkRaw(ctx context.Context, idList ObjectGetBulkIDs, query ObjectGetBulkQuery) ([]json.RawMessage, *http.Response, error) {
+	if s.client.objectStore == nil || len(query) > 0 {
+		return s.getBulk(ctx, idList, query)
 	}
 
-	fmt.Println(queryPath)
+	placeholders := make([]Object, len(idList))
+	for i, id := range idList {
+		placeholders[i].ID = id
+	}
+	return s.getBulkStored(ctx, placeholders)
+}
 
-	req, err := s.client.NewRequest(ctx, http.MethodPost, objectBasePath+"/"+queryPath, idList)
+// getBulkStored returns the objects placeholders refer to, in the same order. Objects
+// held by the client's ObjectStore, by ID or by hash, are read from it and the others
+// are fetched and stored.
+func (s *ObjectService) getBulkStored(ctx context.Context, placeholders []Object) ([]json.RawMessage, *http.Response, error) {
+	store := s.client.scopedObjectStore()
+
+	found := map[string]json.RawMessage{}
+	var missing ObjectGetBulkIDs
+	for _, p := range placeholders {
+		if data, ok := store.get(objectRefID, p.ID); ok {
+			found[p.ID] = data
+		} else if data, ok := storedWithID(store, p); ok {
+			found[p.ID] = data
+		} else {
+			missing = append(missing, p.ID)
+		}
+	}
+
+	var resp *http.Response
+	if len(missing) == 0 {
+		ids := make(ObjectGetBulkIDs, len(placeholders))
+		for i, p := range placeholders {
+			ids[i] = p.ID
+		}
+		req, err := s.client.NewRequest(ctx, http.MethodPost, objectBasePath+"/getbulk", ids)
+		if err != nil {
+			return nil, nil, err
+		}
+		resp = storedResponse(req)
+	} else {
+		fetched, r, err := s.getBulk(ctx, missing, nil)
+		if err != nil {
+			return nil, r, err
+		}
+		resp = r
+
+		for _, data := range fetched {
+			var keys struct {
+				ID string `json:"_id"`
+			}
+			err = json.Unmarshal(data, &keys)
+			if err != nil {
+				return nil, resp, err
+			}
+
+			found[keys.ID] = data
+			store.put(data)
+		}
+	}
+
+	resource := []json.RawMessage{}
+	for _, p := range placeholders {
+		if data, ok := found[p.ID]; ok {
+			resource = append(resource, data)
+		}
+	}
+
+	return resource, resp, nil
+}
+
+// storedWithID returns the stored object with the hash of a placeholder, as the
+// object with the placeholder's ID. Different objects can share a hash, so the stored
+// one may carry another ID.
+func storedWithID(store *ObjectStore, p Object) (json.RawMessage, bool) {
+	data, ok := store.get(objectRefHash, p.Hash)
+	if !ok {
+		return nil, false
+	}
+
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(data, &fields)
+	if err != nil {
+		return nil, false
+	}
+
+	var id string
+	json.Unmarshal(fields["_id"], &id)
+	if id == p.ID {
+		return data, true
+	}
+
+	fields["_id"], err = json.Marshal(p.ID)
+	if err != nil {
+		return nil, false
+	}
+	data, err = json.Marshal(fields)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+func (s *ObjectService) getBulk(ctx context.Context, idList ObjectGetBulkIDs, query ObjectGetBulkQuery) ([]json.RawMessage, *http.Response, error) {
+	resource := []json.RawMessage{}
+
+	params := url.Values{}
+	for k, v := range query {
+		params.Set(k, v)
+	}
+
+	path := objectBasePath + "/getbulk"
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+
+	req, err := s.client.NewRequest(ctx, http.MethodPost, path, idList)
 	if err != nil {
 		return resource, nil, err
 	}
 
-	resp, _, err := s.client.Do(ctx, req, &resource, false)
+	resp, _, err := s.client.Do(ctx, req, &resource, true)
 	if err != nil {
 		return resource, nil, err
 	}
 
 	return resource, resp, nil
 }
+
+// forget removes an object that is about to change from the client's ObjectStore.
+func (s *ObjectService) forget(id string) {
+	if store := s.client.scopedObjectStore(); store != nil {
+		store.Remove(id)
+	}
+}
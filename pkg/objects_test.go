@@ -0,0 +1,65 @@
+package gospeckle
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestGetBulkStoredSharedHash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gospeckle-objects")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	apiURL, _ := url.Parse("http://speckle.test")
+	client := NewClient(nil, apiURL, nil, "v1", "token")
+	client.SetObjectStore(NewObjectStore(dir, 0))
+
+	store := client.scopedObjectStore()
+	for _, o := range []string{
+		`{"_id": "a", "hash": "h", "type": "Point", "value": [0, 0, 0]}`,
+		`{"_id": "b", "hash": "h", "type": "Point", "value": [0, 0, 0]}`,
+	} {
+		err = store.put(json.RawMessage(o))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	placeholders := make([]Object, 3)
+	for i, id := range []string{"a", "b", "c"} {
+		placeholders[i].ID = id
+		placeholders[i].Hash = "h"
+	}
+	objects, _, err := client.Object.getBulkStored(context.Background(), placeholders)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for _, data := range objects {
+		var o struct {
+			ID    string    `json:"_id"`
+			Value []float64 `json:"value"`
+		}
+		err = json.Unmarshal(data, &o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(o.Value) != 3 {
+			t.Errorf("object %v: got value %v, want the stored geometry", o.ID, o.Value)
+		}
+		ids = append(ids, o.ID)
+	}
+
+	want := []string{"a", "b", "c"}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("got %v, want %v", ids, want)
+	}
+}
@@ -0,0 +1,389 @@
+package gospeckle
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Kinds of references an ObjectStore keeps to its blobs.
+const (
+	objectRefID   = "id"
+	objectRefHash = "hash"
+)
+
+// objectStoreStatusHeader is set to hit on the responses of requests an ObjectStore
+// served without contacting the server.
+const objectStoreStatusHeader = "X-Gospeckle-Object-Store"
+
+// ObjectStore is a local, content-addressed store of objects. Each object is kept as
+// the JSON the server sent, so that fields Object doesn't declare survive, once in
+// blobs/<sha256 of its JSON>, and refs/id/<_id> and refs/hash/<hash> point to
+// the blob holding it. Blobs are verified against their name when they are read, and
+// GC removes the least recently used ones once the store grows beyond MaxSize.
+//
+// A client keeps its references under refs/<server>/<token>, both hashed, so that
+// objects of one server aren't taken for those of another and users sharing a store
+// don't see each other's objects.
+type ObjectStore struct {
+	Dir string
+	// MaxSize is the size in bytes GC shrinks the store to. Zero means unbounded.
+	MaxSize int64
+
+	// server and token are the hashes the references of a client are kept under.
+	server string
+	token  string
+}
+
+// ObjectStoreGCResult describes what ObjectStore.GC removed.
+type ObjectStoreGCResult struct {
+	CorruptBlobs int
+	EvictedBlobs int
+	DanglingRefs int
+	FreedBytes   int64
+	Size         int64
+}
+
+// NewObjectStore returns an ObjectStore in dir.
+func NewObjectStore(dir string, maxSize int64) *ObjectStore {
+	return &ObjectStore{Dir: dir, MaxSize: maxSize}
+}
+
+// SetObjectStore makes ObjectService.Get, ObjectService.GetBulk and
+// StreamService.ListObjects look objects up in store before fetching them, and store
+// the objects they fetch. A nil store disables it.
+func (c *Client) SetObjectStore(store *ObjectStore) {
+	c.objectStore = store
+}
+
+// scopedObjectStore returns the client's ObjectStore, keeping references under the
+// client's server and current token, or nil if it has none.
+func (c *Client) scopedObjectStore() *ObjectStore {
+	if c.objectStore == nil {
+		return nil
+	}
+
+	scoped := *c.objectStore
+	scoped.server = hashHex(c.APIURL.String())[:16]
+	scoped.token = hashHex(c.currentToken())[:16]
+	return &scoped
+}
+
+// storedResponse returns the response to a request the object store served without
+// contacting the server.
+func storedResponse(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{objectStoreStatusHeader: []string{"hit"}},
+		Body:       http.NoBody,
+		Request:    req,
+	}
+}
+
+// GetByID returns the object with an ID, if the store holds it.
+func (s *ObjectStore) GetByID(id string) (Object, bool) {
+	return s.getObject(objectRefID, id)
+}
+
+// GetByHash returns the object with a hash, if the store holds it.
+func (s *ObjectStore) GetByHash(hash string) (Object, bool) {
+	return s.getObject(objectRefHash, hash)
+}
+
+func (s *ObjectStore) getObject(kind string, key string) (Object, bool) {
+	var o Object
+
+	data, ok := s.get(kind, key)
+	if !ok {
+		return o, false
+	}
+
+	err := json.Unmarshal(data, &o)
+	if err != nil {
+		return o, false
+	}
+	return o, true
+}
+
+// get returns the JSON of an object, verifying it against the name of its blob.
+func (s *ObjectStore) get(kind string, key string) (json.RawMessage, bool) {
+	if key == "" {
+		return nil, false
+	}
+
+	ref, err := ioutil.ReadFile(s.refPath(kind, key))
+	if err != nil {
+		return nil, false
+	}
+
+	blob := s.blobPath(string(ref))
+	data, err := ioutil.ReadFile(blob)
+	if err != nil {
+		return nil, false
+	}
+
+	if hashHex(string(data)) != string(ref) {
+		// The blob is corrupt, it will be fetched and stored again.
+		os.Remove(blob)
+		return nil, false
+	}
+
+	// The modification time is the blob's last use, which GC evicts by.
+	now := time.Now()
+	os.Chtimes(blob, now, now)
+
+	return data, true
+}
+
+// Put stores an object, referenced by its ID and its hash.
+func (s *ObjectStore) Put(o Object) error {
+	data, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+	return s.put(data)
+}
+
+// put stores the JSON of an object, referenced by its ID and its hash.
+func (s *ObjectStore) put(raw json.RawMessage) error {
+	var keys struct {
+		ID   string `json:"_id"`
+		Hash string `json:"hash"`
+	}
+
+	err := json.Unmarshal(raw, &keys)
+	if err != nil {
+		return err
+	}
+	if keys.ID == "" && keys.Hash == "" {
+		return fmt.Errorf("cannot store an object without an ID or a hash")
+	}
+
+	var buf bytes.Buffer
+	err = json.Compact(&buf, raw)
+	if err != nil {
+		return err
+	}
+	data := buf.Bytes()
+
+	sum := hashHex(string(data))
+	err = writeFileAtomic(s.blobPath(sum), data)
+	if err != nil {
+		return err
+	}
+
+	if keys.ID != "" {
+		err = writeFileAtomic(s.refPath(objectRefID, keys.ID), []byte(sum))
+		if err != nil {
+			return err
+		}
+	}
+	if keys.Hash != "" {
+		err = writeFileAtomic(s.refPath(objectRefHash, keys.Hash), []byte(sum))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Remove forgets the object with an ID, and its hash if it still refers to the same
+// object. A client's store forgets it for every token of the client's server. The blob
+// is left for GC to collect, since other references may still point to it.
+func (s *ObjectStore) Remove(id string) error {
+	dirs := []string{s.refDir()}
+	if s.server != "" {
+		var err error
+		dirs, err = filepath.Glob(filepath.Join(s.Dir, "refs", s.server, "*"))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, dir := range dirs {
+		err := s.removeRefs(dir, id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeRefs removes the references to the object with an ID from a directory of
+// references.
+func (s *ObjectStore) removeRefs(dir string, id string) error {
+	idRef := filepath.Join(dir, objectRefID, hashHex(id))
+	sum, err := ioutil.ReadFile(idRef)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var keys struct {
+		Hash string `json:"hash"`
+	}
+	data, err := ioutil.ReadFile(s.blobPath(string(sum)))
+	if err == nil && json.Unmarshal(data, &keys) == nil && keys.Hash != "" {
+		hashRef := filepath.Join(dir, objectRefHash, hashHex(keys.Hash))
+		if ref, err := ioutil.ReadFile(hashRef); err == nil && bytes.Equal(ref, sum) {
+			err = os.Remove(hashRef)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+
+	err = os.Remove(idRef)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// GC verifies every blob, removing the corrupt ones, then removes the least recently
+// used blobs until the store fits in MaxSize, and finally the references to removed
+// blobs.
+func (s *ObjectStore) GC() (ObjectStoreGCResult, error) {
+	var result ObjectStoreGCResult
+
+	infos, err := ioutil.ReadDir(filepath.Join(s.Dir, "blobs"))
+	if err != nil && !os.IsNotExist(err) {
+		return result, err
+	}
+
+	var blobs []os.FileInfo
+	for _, info := range infos {
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(s.blobPath(info.Name()))
+		if err != nil {
+			return result, err
+		}
+
+		if hashHex(string(data)) != info.Name() {
+			err = os.Remove(s.blobPath(info.Name()))
+			if err != nil {
+				return result, err
+			}
+			result.CorruptBlobs++
+			result.FreedBytes += info.Size()
+			continue
+		}
+
+		blobs = append(blobs, info)
+		result.Size += info.Size()
+	}
+
+	if s.MaxSize > 0 && result.Size > s.MaxSize {
+		sort.Slice(blobs, func(i, j int) bool {
+			return blobs[i].ModTime().Before(blobs[j].ModTime())
+		})
+
+		for _, info := range blobs {
+			if result.Size <= s.MaxSize {
+				break
+			}
+
+			err = os.Remove(s.blobPath(info.Name()))
+			if err != nil {
+				return result, err
+			}
+			result.EvictedBlobs++
+			result.FreedBytes += info.Size()
+			result.Size -= info.Size()
+		}
+	}
+
+	// References are walked for every server and token.
+	err = filepath.Walk(filepath.Join(s.Dir, "refs"), func(refPath string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			return nil
+		}
+
+		ref, err := ioutil.ReadFile(refPath)
+		if err != nil {
+			return err
+		}
+
+		if _, err := os.Stat(s.blobPath(string(ref))); os.IsNotExist(err) {
+			err = os.Remove(refPath)
+			if err != nil {
+				return err
+			}
+			result.DanglingRefs++
+		}
+		return nil
+	})
+
+	return result, err
+}
+
+func (s *ObjectStore) blobPath(sum string) string {
+	return filepath.Join(s.Dir, "blobs", sum)
+}
+
+// refPath returns the path of a reference. Keys are hashed, since IDs and hashes come
+// from the server and aren't guaranteed to be valid file names.
+func (s *ObjectStore) refPath(kind string, key string) string {
+	return filepath.Join(s.refDir(), kind, hashHex(key))
+}
+
+// refDir returns the directory the store's references are kept in.
+func (s *ObjectStore) refDir() string {
+	if s.server == "" {
+		return filepath.Join(s.Dir, "refs")
+	}
+	return filepath.Join(s.Dir, "refs", s.server, s.token)
+}
+
+// writeFileAtomic writes a file through a temporary file, so that readers never see
+// it partially written.
+func writeFileAtomic(path string, data []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(data)
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
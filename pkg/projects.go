@@ -37,6 +37,16 @@ type ProjectRequest struct {
 	Streams []string `json:"streams"`
 }
 
+// Request returns a ProjectRequest that recreates the project's current state.
+func (p Project) Request() ProjectRequest {
+	return ProjectRequest{
+		RequestMetadata: p.Metadata.Request(),
+		Name:            p.Name,
+		Tags:            p.Tags,
+		Streams:         p.Streams,
+	}
+}
+
 // ProjectService is the service that communicates with the Projects API
 type ProjectService struct {
 	client *Client
@@ -125,6 +135,22 @@ func (s *ProjectService) Update(ctx context.Context, id string, update ProjectRe
 	return resp, nil
 }
 
+// Restore puts a project back in a state returned by Get earlier. Unlike Update, the fields
+// that were empty are sent too, so that they are cleared.
+func (s *ProjectService) Restore(ctx context.Context, id string, prior Project) (*http.Response, error) {
+	req, err := s.client.NewRequest(ctx, http.MethodPut, projectBasePath+"/"+id, restoreFields(prior.Request()))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, _, err := s.client.Do(ctx, req, nil, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
 // Delete deletes a specific project indexed by it's ID
 func (s *ProjectService) Delete(ctx context.Context, id string) (*http.Response, error) {
 	req, err := s.client.NewRequest(ctx, http.MethodDelete, projectBasePath+"/"+id, nil)
@@ -166,7 +192,7 @@ func (s *ProjectService) GetComments(ctx context.Context, id string) ([]Comment,
 		return *resource, nil, err
 	}
 
-	resp, _, err := s.client.Do(ctx, req, resource, false)
+	resp, _, err := s.client.Do(ctx, req, resource, true)
 	if err != nil {
 		return *resource, nil, err
 	}
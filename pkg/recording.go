@@ -0,0 +1,151 @@
+package gospeckle
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// RecordedFrame is a websocket frame captured by a FrameRecorder. Frames that are JSON
+// messages are stored in Message, with the server's args mapped to the payload; any
+// other frame, such as heartbeats, is stored as is in Raw.
+type RecordedFrame struct {
+	Time      time.Time         `json:"time"`
+	Direction FrameDirection    `json:"direction"`
+	Message   *WebsocketMessage `json:"message,omitempty"`
+	Raw       string            `json:"raw,omitempty"`
+}
+
+// FrameRecorder writes websocket frames as JSON lines. It is safe for concurrent use,
+// and its Record method can be used directly as a Session's OnFrame option.
+type FrameRecorder struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+// NewFrameRecorder returns a FrameRecorder writing to w.
+func NewFrameRecorder(w io.Writer) *FrameRecorder {
+	return &FrameRecorder{enc: json.NewEncoder(w)}
+}
+
+// Record writes a frame with the current time.
+func (r *FrameRecorder) Record(direction FrameDirection, data []byte) {
+	frame := RecordedFrame{Time: time.Now(), Direction: direction}
+
+	var msg eventFrame
+	if err := json.Unmarshal(data, &msg); err == nil && msg.EventName != "" {
+		payload := msg.Args
+		if len(payload) == 0 {
+			payload = msg.Payload
+		}
+
+		frame.Message = &WebsocketMessage{
+			EventName: msg.EventName,
+			StreamID:  msg.StreamID,
+		}
+		if len(payload) > 0 {
+			frame.Message.Payload = payload
+		}
+	} else {
+		frame.Raw = string(data)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err == nil {
+		r.err = r.enc.Encode(frame)
+	}
+}
+
+// Err returns the first error encountered while writing frames.
+func (r *FrameRecorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// ReadRecording reads the frames written by a FrameRecorder.
+func ReadRecording(r io.Reader) ([]RecordedFrame, error) {
+	var frames []RecordedFrame
+
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var frame RecordedFrame
+		if err := dec.Decode(&frame); err == io.EOF {
+			break
+		} else if err != nil {
+			return frames, err
+		}
+		frames = append(frames, frame)
+	}
+
+	return frames, nil
+}
+
+// ReplayOptions configures Replay.
+type ReplayOptions struct {
+	// Speed scales the delays between frames: 1 replays at the original pace, 2 twice as
+	// fast and so on. 0 sends every frame without waiting.
+	Speed float64
+	// Directions limits the frames replayed. Defaults to frames received by the
+	// recorded session.
+	Directions []FrameDirection
+	// OnSend is called after each frame has been sent.
+	OnSend func(frame RecordedFrame)
+}
+
+// Replay re-emits the messages of a recording through a session, on the session's
+// stream. Frames without a message, such as heartbeats, are skipped.
+func Replay(ctx context.Context, session *Session, frames []RecordedFrame, opts ReplayOptions) error {
+	directions := opts.Directions
+	if len(directions) == 0 {
+		directions = []FrameDirection{FrameIn}
+	}
+
+	var previous time.Time
+
+	for _, frame := range frames {
+		if frame.Message == nil || !hasDirection(directions, frame.Direction) {
+			continue
+		}
+
+		if opts.Speed > 0 && !previous.IsZero() {
+			delay := time.Duration(float64(frame.Time.Sub(previous)) / opts.Speed)
+			if delay > 0 {
+				select {
+				case <-time.After(delay):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		}
+		previous = frame.Time
+
+		message := *frame.Message
+		message.StreamID = session.StreamID()
+
+		if err := session.Send(message); err != nil {
+			return err
+		}
+
+		if opts.OnSend != nil {
+			opts.OnSend(frame)
+		}
+	}
+
+	return nil
+}
+
+func hasDirection(directions []FrameDirection, direction FrameDirection) bool {
+	for _, d := range directions {
+		if d == direction {
+			return true
+		}
+	}
+	return false
+}
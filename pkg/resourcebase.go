@@ -1,6 +1,10 @@
 package gospeckle
 
-import "time"
+import (
+	"reflect"
+	"strings"
+	"time"
+)
 
 // Metadata is the common metadata all resources (bar accounts) possess when returned
 // from the Speckle Server.
@@ -20,8 +24,54 @@ type Metadata struct {
 // RequestMetadata is the common metadata all resources (bar accounts) should posess
 // when creating/updating resources to the Speckle Server.
 type RequestMetadata struct {
-	Private           bool     `json:"private,omitempty"`
-	CanRead           []string `json:"canRead,omitempty"`
-	CanWrite          []string `json:"canWrite,omitempty"`
-	AnonymousComments bool     `json:"anonymousComments,omitempty"`
+	Private           bool     `json:"private,omitempty" yaml:"private,omitempty"`
+	CanRead           []string `json:"canRead,omitempty" yaml:"canRead,omitempty"`
+	CanWrite          []string `json:"canWrite,omitempty" yaml:"canWrite,omitempty"`
+	AnonymousComments bool     `json:"anonymousComments,omitempty" yaml:"anonymousComments,omitempty"`
+}
+
+// Request returns the part of the metadata that can be sent back to the Speckle Server
+// when creating or updating a resource.
+func (m Metadata) Request() RequestMetadata {
+	return RequestMetadata{
+		Private:           m.Private,
+		CanRead:           m.CanRead,
+		CanWrite:          m.CanWrite,
+		AnonymousComments: m.AnonymousComments,
+	}
+}
+
+// restoreFields returns a request payload holding every field of request, including
+// the empty ones its omitempty tags leave out, so that sending it clears the fields
+// that were empty rather than leaving them as they are.
+func restoreFields(request interface{}) map[string]interface{} {
+	fields := map[string]interface{}{}
+	addRestoreFields(reflect.ValueOf(request), fields)
+	return fields
+}
+
+func addRestoreFields(v reflect.Value, fields map[string]interface{}) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			addRestoreFields(v.Field(i), fields)
+			continue
+		}
+
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" || f.PkgPath != "" {
+			continue
+		}
+
+		value := v.Field(i)
+		switch {
+		case value.Kind() == reflect.Slice && value.Len() == 0:
+			fields[name] = []interface{}{}
+		case value.Kind() == reflect.Ptr && value.IsNil():
+			// There is no value to restore.
+		default:
+			fields[name] = value.Interface()
+		}
+	}
 }
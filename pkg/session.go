@@ -0,0 +1,489 @@
+package gospeckle
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	defaultHeartbeatInterval = 30 * time.Second
+	defaultMinBackoff        = time.Second
+	defaultMaxBackoff        = 30 * time.Second
+	closeTimeout             = time.Second
+)
+
+// ErrSessionNotConnected is returned when writing to a Session that currently has no connection.
+var ErrSessionNotConnected = errors.New("websocket session is not connected")
+
+// ErrSessionStarted is returned when connecting a Session that was already connected.
+var ErrSessionStarted = errors.New("websocket session was already connected")
+
+// FrameDirection tells whether a websocket frame was received or sent.
+type FrameDirection string
+
+const (
+	// FrameIn is a frame received from the server.
+	FrameIn FrameDirection = "in"
+	// FrameOut is a frame sent to the server.
+	FrameOut FrameDirection = "out"
+)
+
+// SessionState is the state of the connection held by a Session.
+type SessionState int
+
+const (
+	// SessionConnecting means the session is dialing the server.
+	SessionConnecting SessionState = iota
+	// SessionConnected means the session holds a live connection.
+	SessionConnected
+	// SessionDisconnected means the connection dropped and the session is waiting to reconnect.
+	SessionDisconnected
+	// SessionClosed means the session was closed and will not reconnect.
+	SessionClosed
+)
+
+func (s SessionState) String() string {
+	switch s {
+	case SessionConnecting:
+		return "connecting"
+	case SessionConnected:
+		return "connected"
+	case SessionDisconnected:
+		return "disconnected"
+	case SessionClosed:
+		return "closed"
+	}
+	return "unknown"
+}
+
+// SessionOptions configures a Session. The zero value uses sensible defaults.
+type SessionOptions struct {
+	// HeartbeatInterval is how often an "alive" message is sent to the server.
+	HeartbeatInterval time.Duration
+	// MinBackoff is the delay before the first reconnection attempt. It doubles after
+	// each failed attempt up to MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// OnStateChange is called every time the connection state changes. err holds the
+	// reason for a disconnection, if any.
+	OnStateChange func(state SessionState, err error)
+	// OnMessage is called with every frame received from the server, apart from heartbeats,
+	// before it is decoded and dispatched to the handlers registered with On.
+	OnMessage func(message []byte)
+	// OnFrame is called with every text frame read from or written to the connection,
+	// heartbeats included.
+	OnFrame func(direction FrameDirection, data []byte)
+	// Lifecycle, if set, makes the session create or reuse its APIClient and keep the
+	// client's online status up to date.
+	Lifecycle *ClientLifecycle
+}
+
+// Session is a websocket connection to a stream that answers the server's heartbeat
+// and transparently reconnects, re-joining the same stream as the same client.
+// All of its methods are safe for concurrent use.
+type Session struct {
+	client   *Client
+	clientID string
+	streamID string
+	opts     SessionOptions
+
+	mu      sync.Mutex
+	conn    *websocket.Conn
+	state   SessionState
+	cancel  context.CancelFunc
+	closing bool
+	// started is set once Connect is called, and reset if it fails.
+	started bool
+	done    chan struct{}
+
+	// statusUpdates queues the online status updates of a ClientLifecycle's client,
+	// and statusDone is closed once they were all sent.
+	statusUpdates chan bool
+	statusDone    chan struct{}
+	releaseOnce   sync.Once
+	releaseErr    error
+
+	// gorilla connections support a single concurrent writer.
+	writeMu sync.Mutex
+
+	handlersMu sync.RWMutex
+	handlers   map[string][]EventHandler
+	fallback   EventHandler
+	// taps receive every event before it is routed to handlers.
+	taps []EventHandler
+}
+
+// NewSession returns a Session for a client ID and a stream ID. The session does not
+// dial the server until Connect is called.
+func (c *Client) NewSession(clientID string, streamID string, opts *SessionOptions) *Session {
+	s := &Session{
+		client:   c,
+		clientID: clientID,
+		streamID: streamID,
+		state:    SessionClosed,
+		done:     make(chan struct{}),
+	}
+
+	if opts != nil {
+		s.opts = *opts
+	}
+	if s.opts.HeartbeatInterval <= 0 {
+		s.opts.HeartbeatInterval = defaultHeartbeatInterval
+	}
+	if s.opts.MinBackoff <= 0 {
+		s.opts.MinBackoff = defaultMinBackoff
+	}
+	if s.opts.MaxBackoff < s.opts.MinBackoff {
+		s.opts.MaxBackoff = defaultMaxBackoff
+		if s.opts.MaxBackoff < s.opts.MinBackoff {
+			s.opts.MaxBackoff = s.opts.MinBackoff
+		}
+	}
+
+	return s
+}
+
+// ClientID returns the ID of the client the session connects as. With a ClientLifecycle
+// and no client ID given, it is only known once Connect has returned.
+func (s *Session) ClientID() string {
+	return s.clientID
+}
+
+// StreamID returns the ID of the stream the session is joined to.
+func (s *Session) StreamID() string {
+	return s.streamID
+}
+
+// State returns the current connection state.
+func (s *Session) State() SessionState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// Done returns a channel that is closed once the session has been closed.
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Connect dials the server and keeps the session connected in the background until
+// Close is called or ctx is cancelled. An error is returned if the first dial fails,
+// in which case the session is not started and may be connected again. Otherwise a
+// session can only be connected once, and connecting it again returns ErrSessionStarted.
+func (s *Session) Connect(ctx context.Context) error {
+	s.mu.Lock()
+	if s.started {
+		s.mu.Unlock()
+		return ErrSessionStarted
+	}
+	s.started = true
+	s.mu.Unlock()
+
+	s.setState(SessionConnecting, nil)
+
+	err := s.acquireClient(ctx)
+	if err != nil {
+		s.connectFailed(err)
+		return err
+	}
+
+	conn, err := s.dial(ctx)
+	if err != nil {
+		s.release()
+		s.connectFailed(err)
+		return err
+	}
+
+	if s.opts.Lifecycle != nil {
+		s.statusUpdates = make(chan bool, 1)
+		s.statusDone = make(chan struct{})
+		go s.updateStatus(s.statusUpdates, s.statusDone)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	s.mu.Lock()
+	s.cancel = cancel
+	// Set here rather than only in serve so the session can be written to as soon
+	// as Connect returns.
+	s.conn = conn
+	s.mu.Unlock()
+
+	s.setState(SessionConnected, nil)
+
+	go s.run(ctx, conn)
+
+	return nil
+}
+
+// connectFailed returns the session to its initial state after Connect failed, so
+// that it can be connected again.
+func (s *Session) connectFailed(err error) {
+	s.mu.Lock()
+	s.started = false
+	s.mu.Unlock()
+
+	s.setState(SessionClosed, err)
+}
+
+// Close cleanly closes the connection and stops reconnecting. It waits for the server
+// to acknowledge the close for up to a second, then releases the session's client if
+// it has a ClientLifecycle.
+func (s *Session) Close() error {
+	s.mu.Lock()
+	conn := s.conn
+	cancel := s.cancel
+	closing := s.closing
+	// A session that isn't connected yet has nothing to close, and must still be
+	// closed once it is.
+	if cancel != nil {
+		s.closing = true
+	}
+	s.mu.Unlock()
+
+	if cancel == nil || closing {
+		return nil
+	}
+
+	var err error
+	if conn != nil {
+		msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+		err = conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(closeTimeout))
+
+		select {
+		case <-s.done:
+		case <-time.After(closeTimeout):
+		}
+	}
+
+	cancel()
+	<-s.done
+
+	if releaseErr := s.releaseClient(); err == nil {
+		err = releaseErr
+	}
+
+	return err
+}
+
+// WriteMessage sends a text frame to the server.
+func (s *Session) WriteMessage(data []byte) error {
+	s.mu.Lock()
+	conn := s.conn
+	s.mu.Unlock()
+
+	if conn == nil {
+		return ErrSessionNotConnected
+	}
+
+	return s.write(conn, data)
+}
+
+// write sends a text frame on a connection, serialising it with every other write.
+func (s *Session) write(conn *websocket.Conn, data []byte) error {
+	s.writeMu.Lock()
+	err := conn.WriteMessage(websocket.TextMessage, data)
+	s.writeMu.Unlock()
+
+	if err == nil && s.opts.OnFrame != nil {
+		s.opts.OnFrame(FrameOut, data)
+	}
+
+	return err
+}
+
+// WriteJSON sends v to the server encoded as JSON.
+func (s *Session) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return s.WriteMessage(data)
+}
+
+// Send sends a message to the server. The session's stream is used if the message
+// doesn't specify one.
+func (s *Session) Send(message WebsocketMessage) error {
+	if message.StreamID == "" {
+		message.StreamID = s.streamID
+	}
+
+	return s.WriteJSON(message)
+}
+
+func (s *Session) isClosing() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closing
+}
+
+func (s *Session) setState(state SessionState, err error) {
+	s.mu.Lock()
+	changed := s.state != state
+	s.state = state
+	s.mu.Unlock()
+
+	if changed && s.opts.OnStateChange != nil {
+		s.opts.OnStateChange(state, err)
+	}
+}
+
+// websocketURL returns the URL used to connect to the server. The client's
+// WebsocketsURL is copied rather than modified.
+func (s *Session) websocketURL() string {
+	params := url.Values{}
+
+	params.Add("access_token", s.client.currentToken())
+	if s.clientID != "" {
+		params.Add("client_id", s.clientID)
+	}
+	if s.streamID != "" {
+		params.Add("stream_id", s.streamID)
+	}
+
+	u := *s.client.WebsocketsURL
+	u.RawQuery = params.Encode()
+
+	return u.String()
+}
+
+func (s *Session) dial(ctx context.Context) (*websocket.Conn, error) {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, s.websocketURL(), nil)
+	return conn, err
+}
+
+// run serves connections until the session's context is cancelled, redialing with
+// exponential backoff whenever the connection drops. The session's client is then
+// released, whether the session was closed or its context cancelled.
+func (s *Session) run(ctx context.Context, conn *websocket.Conn) {
+	defer func() {
+		if s.statusUpdates != nil {
+			close(s.statusUpdates)
+		}
+		s.releaseClient()
+		close(s.done)
+	}()
+
+	backoff := s.opts.MinBackoff
+
+	for {
+		err := s.serve(ctx, conn)
+
+		if ctx.Err() != nil || s.isClosing() {
+			s.setState(SessionClosed, nil)
+			return
+		}
+
+		s.setState(SessionDisconnected, err)
+		s.setOnline(false)
+
+		for {
+			select {
+			case <-ctx.Done():
+				s.setState(SessionClosed, nil)
+				return
+			case <-time.After(backoff):
+			}
+
+			s.setState(SessionConnecting, nil)
+
+			conn, err = s.dial(ctx)
+			if err == nil {
+				backoff = s.opts.MinBackoff
+				break
+			}
+
+			s.setState(SessionDisconnected, err)
+
+			backoff *= 2
+			if backoff > s.opts.MaxBackoff {
+				backoff = s.opts.MaxBackoff
+			}
+		}
+	}
+}
+
+// serve reads from a connection until it fails or the context is cancelled, answering
+// the server's pings and sending heartbeats in the meantime.
+func (s *Session) serve(ctx context.Context, conn *websocket.Conn) error {
+	s.mu.Lock()
+	s.conn = conn
+	s.mu.Unlock()
+
+	s.setState(SessionConnected, nil)
+	s.setOnline(true)
+
+	stop := make(chan struct{})
+	// heartbeatErr receives the error of a failed heartbeat, which closes the
+	// connection so that the session reconnects.
+	heartbeatErr := make(chan error, 1)
+	defer func() {
+		close(stop)
+
+		s.mu.Lock()
+		s.conn = nil
+		s.mu.Unlock()
+
+		conn.Close()
+	}()
+
+	go func() {
+		ticker := time.NewTicker(s.opts.HeartbeatInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				// Unblocks the pending read below.
+				conn.Close()
+				return
+			case <-stop:
+				return
+			case <-ticker.C:
+				err := s.write(conn, []byte("alive"))
+				if err != nil {
+					heartbeatErr <- err
+					conn.Close()
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			select {
+			case hbErr := <-heartbeatErr:
+				return hbErr
+			default:
+				return err
+			}
+		}
+
+		if s.opts.OnFrame != nil {
+			s.opts.OnFrame(FrameIn, message)
+		}
+
+		if string(message) == "ping" {
+			err = s.write(conn, []byte("alive"))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if s.opts.OnMessage != nil {
+			s.opts.OnMessage(message)
+		}
+
+		s.dispatch(ctx, message)
+	}
+}
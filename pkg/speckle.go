@@ -8,6 +8,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -51,6 +52,14 @@ type Client struct {
 	Token         string      `json:"token"`
 	User          *ClientUser `json:"user"`
 
+	// tokenMu guards Token once the client is shared between goroutines.
+	tokenMu     sync.Mutex
+	tokenSource TokenSource
+	refreshing  *tokenRefresh
+
+	cache       *Cache
+	objectStore *ObjectStore
+
 	// Services used for communicating with the API
 	Account   AccountService
 	APIClient APIClientService
@@ -139,7 +148,7 @@ func (c *Client) NewRequest(ctx context.Context, method, urlStr string, body int
 
 	req.Header.Add("Content-Type", mediaType)
 	req.Header.Add("Accept", mediaType)
-	req.Header.Add("Authorization", c.Token)
+	req.Header.Add("Authorization", c.currentToken())
 	return req, nil
 }
 
@@ -153,14 +162,15 @@ type WebsocketMessage struct {
 func (c *Client) NewWebsocket(clientID string, streamID string) (*websocket.Conn, error) {
 	params := url.Values{}
 
-	params.Add("access_token", c.Token)
+	params.Add("access_token", c.currentToken())
 	params.Add("client_id", clientID)
 	params.Add("stream_id", streamID)
 
-	// Not sure if overwriting the actual WebsocketsURL or just modding it here but not committing it back to the client struct
-	c.WebsocketsURL.RawQuery = params.Encode()
+	// Work on a copy so that concurrent calls don't race on the shared client.
+	wsURL := *c.WebsocketsURL
+	wsURL.RawQuery = params.Encode()
 
-	ws, _, err := websocket.DefaultDialer.Dial(c.WebsocketsURL.String(), nil)
+	ws, _, err := websocket.DefaultDialer.Dial(wsURL.String(), nil)
 
 	if err != nil {
 		return nil, err
@@ -195,19 +205,41 @@ func newResponse(r *http.Response) *ResponseData {
 }
 
 // Do sends an API request and returns the API response. The API response is JSON decoded and stored in the value
-// pointed to by v, or returned as an error if an API error has occurred.
+// pointed to by v, or returned as an error if an API error has occurred. If the client has a TokenSource and the
+// request is rejected with a 401, the token is refreshed and the request is retried once.
 func (c *Client) Do(ctx context.Context, req *http.Request, v interface{}, isList bool) (*http.Response, *ResponseData, error) {
+	return c.do(ctx, req, v, isList, true)
+}
+
+func (c *Client) do(ctx context.Context, req *http.Request, v interface{}, isList bool, refresh bool) (*http.Response, *ResponseData, error) {
 	req = req.WithContext(ctx)
-	resp, err := c.client.Do(req)
+	resp, err := c.send(req)
 	if err != nil {
 		return nil, nil, err
 	}
+
+	var refreshErr error
+	if refresh && resp.StatusCode == http.StatusUnauthorized && c.hasTokenSource() {
+		var retry *http.Request
+		retry, refreshErr = c.reauthenticate(ctx, req)
+		if refreshErr == nil {
+			resp.Body.Close()
+			resp, err = c.send(retry)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
 	responseData := newResponse(resp)
 
 	defer resp.Body.Close()
 
 	err = CheckResponse(responseData, resp)
 	if err != nil {
+		if errorResponse, ok := err.(*ErrorResponse); ok && refreshErr != nil {
+			errorResponse.Message = fmt.Sprintf("%v (refreshing the token failed: %v)", errorResponse.Message, refreshErr)
+		}
 		return resp, nil, err
 	}
 
@@ -227,6 +259,32 @@ func (c *Client) Do(ctx context.Context, req *http.Request, v interface{}, isLis
 	return resp, responseData, err
 }
 
+func (c *Client) hasTokenSource() bool {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+	return c.tokenSource != nil
+}
+
+// reauthenticate refreshes the token a request was rejected with and returns a copy of
+// the request using the new token.
+func (c *Client) reauthenticate(ctx context.Context, req *http.Request) (*http.Request, error) {
+	token, err := c.refreshToken(ctx, req.Header.Get("Authorization"))
+	if err != nil {
+		return nil, err
+	}
+
+	retry := req.Clone(ctx)
+	if req.GetBody != nil {
+		retry.Body, err = req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+	}
+	retry.Header.Set("Authorization", token)
+
+	return retry, nil
+}
+
 func (r *ErrorResponse) Error() string {
 	return fmt.Sprintf("%v %v: %d %v",
 		r.Response.Request.Method, r.Response.Request.URL, r.Response.StatusCode, r.Message)
@@ -281,26 +339,36 @@ type ClientUser struct {
 
 // Login is the function used to login an existing user with an email and a password.
 func (c *Client) Login(ctx context.Context, email string, password string, persistentToken bool) error {
+	clientUser, err := c.authenticate(ctx, email, password)
+
+	c.User = clientUser
+
+	if persistentToken {
+		c.setToken(clientUser.APIToken)
+	} else {
+		c.setToken(clientUser.Token)
+	}
+
+	return err
+}
+
+// authenticate logs in with an email and a password. The request is neither
+// authenticated nor retried, so that it can be used to refresh the client's token.
+func (c *Client) authenticate(ctx context.Context, email string, password string) (*ClientUser, error) {
 	authPayload := AuthPayload{
 		Email:    email,
 		Password: password,
 	}
-	req, err := c.NewRequest(ctx, http.MethodPost, "accounts/login", authPayload)
-	if err != nil {
-		return err
-	}
 
 	clientUser := new(ClientUser)
 
-	_, _, err = c.Do(ctx, req, clientUser, false)
-
-	c.User = clientUser
-
-	if persistentToken {
-		c.Token = clientUser.APIToken
-	} else {
-		c.Token = clientUser.Token
+	req, err := c.NewRequest(ctx, http.MethodPost, "accounts/login", authPayload)
+	if err != nil {
+		return clientUser, err
 	}
+	req.Header.Del("Authorization")
 
-	return err
+	_, _, err = c.do(ctx, req, clientUser, false, false)
+
+	return clientUser, err
 }
@@ -72,6 +72,31 @@ type StreamRequest struct {
 	Children      []string  `json:"children,omitempty"`
 }
 
+// Request returns a StreamRequest that recreates the stream's current state.
+func (s Stream) Request() StreamRequest {
+	objects := make([]*Object, len(s.Objects))
+	for i := range s.Objects {
+		objects[i] = &s.Objects[i]
+	}
+
+	layers := make([]*Layer, len(s.Layers))
+	for i := range s.Layers {
+		layers[i] = &s.Layers[i]
+	}
+
+	return StreamRequest{
+		RequestMetadata: s.Metadata.Request(),
+		Name:            s.Name,
+		Description:     s.Description,
+		Tags:            s.Tags,
+		CommitMessage:   s.CommitMessage,
+		Objects:         objects,
+		Layers:          layers,
+		Parent:          s.Parent,
+		Children:        s.Children,
+	}
+}
+
 // StreamCloneRequest is the request payload used to clone a stream
 type StreamCloneRequest struct {
 	Name string `json:"name,omitemtpy"`
@@ -184,6 +209,22 @@ func (s *StreamService) Update(ctx context.Context, id string, update StreamRequ
 	return resp, nil
 }
 
+// Restore puts a stream back in a state returned by Get earlier. Unlike Update, the fields
+// that were empty are sent too, so that they are cleared.
+func (s *StreamService) Restore(ctx context.Context, id string, prior Stream) (*http.Response, error) {
+	req, err := s.client.NewRequest(ctx, http.MethodPut, streamBasePath+"/"+id, restoreFields(prior.Request()))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, _, err := s.client.Do(ctx, req, nil, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
 // Delete deletes a specific stream indexed by it's ID
 func (s *StreamService) Delete(ctx context.Context, id string) (*http.Response, error) {
 	req, err := s.client.NewRequest(ctx, http.MethodDelete, streamBasePath+"/"+id, nil)
@@ -225,7 +266,7 @@ func (s *StreamService) GetComments(ctx context.Context, id string) ([]Comment,
 		return *resource, nil, err
 	}
 
-	resp, _, err := s.client.Do(ctx, req, resource, false)
+	resp, _, err := s.client.Do(ctx, req, resource, true)
 	if err != nil {
 		return *resource, nil, err
 	}
@@ -286,8 +327,14 @@ func (s *StreamService) Diff(ctx context.Context, streamA string, streamB string
 	return *resource, resp, nil
 }
 
-// ListObjects retrieves a list of objects in the Stream.
+// ListObjects retrieves a list of objects in the Stream. If the client has an
+// ObjectStore, only the stream's object IDs are fetched and objects the store holds
+// aren't downloaded again.
 func (s *StreamService) ListObjects(ctx context.Context, streamID string) ([]map[string]interface{}, *http.Response, error) {
+	if s.client.objectStore != nil {
+		return s.listStoredObjects(ctx, streamID)
+	}
+
 	resource := new([]map[string]interface{})
 
 	req, err := s.client.NewRequest(ctx, http.MethodGet, streamBasePath+"/"+streamID+"/objects", nil)
@@ -303,6 +350,35 @@ func (s *StreamService) ListObjects(ctx context.Context, streamID string) ([]map
 	return *resource, resp, nil
 }
 
+func (s *StreamService) listStoredObjects(ctx context.Context, streamID string) ([]map[string]interface{}, *http.Response, error) {
+	resource := []map[string]interface{}{}
+
+	stream, resp, err := s.Get(ctx, streamID)
+	if err != nil {
+		return resource, resp, err
+	}
+
+	objects, bulkResp, err := s.client.Object.getBulkStored(ctx, stream.Objects)
+	if err != nil {
+		return resource, bulkResp, err
+	}
+	if bulkResp.Header.Get(objectStoreStatusHeader) == "" {
+		// Objects were fetched, the response to that request is more telling.
+		resp = bulkResp
+	}
+
+	for _, data := range objects {
+		var o map[string]interface{}
+		err = json.Unmarshal(data, &o)
+		if err != nil {
+			return resource, resp, err
+		}
+		resource = append(resource, o)
+	}
+
+	return resource, resp, nil
+}
+
 // ListClients retrieves a list of clients suscribed to the Stream.
 func (s *StreamService) ListClients(ctx context.Context, streamID string) ([]APIClient, *http.Response, error) {
 	resource := new([]APIClient)
@@ -0,0 +1,223 @@
+package gospeckle
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+// ErrTokenNotRefreshable is returned by token sources that cannot obtain a new token.
+var ErrTokenNotRefreshable = errors.New("token cannot be refreshed")
+
+// TokenSource provides the token a Client authenticates with. Token returns the
+// current token, and Refresh obtains a new one after the server has rejected it.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+	Refresh(ctx context.Context) (string, error)
+}
+
+// SetTokenSource makes the client authenticate with tokens from ts. The current token
+// is fetched immediately; afterwards, a request answered with a 401 refreshes the token
+// once and is retried. Concurrent refreshes are collapsed into one.
+func (c *Client) SetTokenSource(ctx context.Context, ts TokenSource) error {
+	token, err := ts.Token(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+
+	c.tokenSource = ts
+	c.Token = token
+	return nil
+}
+
+// tokenRefresh is a token refresh in progress, which other requests can wait for.
+type tokenRefresh struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+// currentToken returns the token requests are currently authenticated with.
+func (c *Client) currentToken() string {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+	return c.Token
+}
+
+func (c *Client) setToken(token string) {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+	c.Token = token
+}
+
+// refreshToken replaces a token the server rejected. If the token was already replaced
+// by another request, the new token is returned without refreshing it again, and if a
+// refresh is already in progress, its result is waited for.
+func (c *Client) refreshToken(ctx context.Context, rejected string) (string, error) {
+	c.tokenMu.Lock()
+	if c.Token != rejected {
+		token := c.Token
+		c.tokenMu.Unlock()
+		return token, nil
+	}
+
+	if r := c.refreshing; r != nil {
+		c.tokenMu.Unlock()
+		select {
+		case <-r.done:
+			return r.token, r.err
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+
+	r := &tokenRefresh{done: make(chan struct{})}
+	c.refreshing = r
+	ts := c.tokenSource
+	c.tokenMu.Unlock()
+
+	r.token, r.err = ts.Refresh(ctx)
+
+	c.tokenMu.Lock()
+	if r.err == nil {
+		c.Token = r.token
+	}
+	c.refreshing = nil
+	c.tokenMu.Unlock()
+
+	close(r.done)
+
+	return r.token, r.err
+}
+
+// StaticTokenSource always returns the same token, which cannot be refreshed.
+type StaticTokenSource string
+
+// Token returns the token.
+func (s StaticTokenSource) Token(ctx context.Context) (string, error) {
+	return string(s), nil
+}
+
+// Refresh returns ErrTokenNotRefreshable.
+func (s StaticTokenSource) Refresh(ctx context.Context) (string, error) {
+	return "", ErrTokenNotRefreshable
+}
+
+// LoginTokenSource logs in with an email and a password to get a token, and logs in
+// again to refresh it.
+type LoginTokenSource struct {
+	client   *Client
+	email    string
+	password string
+	// persistent selects the user's API token rather than a session token.
+	persistent bool
+
+	mu    sync.Mutex
+	token string
+}
+
+// NewLoginTokenSource returns a LoginTokenSource logging in through c. The login
+// requests aren't authenticated, so c can itself use the returned source.
+func NewLoginTokenSource(c *Client, email string, password string, persistentToken bool) *LoginTokenSource {
+	return &LoginTokenSource{
+		client:     c,
+		email:      email,
+		password:   password,
+		persistent: persistentToken,
+	}
+}
+
+// Token returns the last token obtained, logging in if there is none.
+func (s *LoginTokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	token := s.token
+	s.mu.Unlock()
+
+	if token != "" {
+		return token, nil
+	}
+	return s.Refresh(ctx)
+}
+
+// Refresh logs in again.
+func (s *LoginTokenSource) Refresh(ctx context.Context) (string, error) {
+	user, err := s.client.authenticate(ctx, s.email, s.password)
+	if err != nil {
+		return "", err
+	}
+
+	token := user.Token
+	if s.persistent {
+		token = user.APIToken
+	}
+
+	s.mu.Lock()
+	s.token = token
+	s.mu.Unlock()
+
+	return token, nil
+}
+
+// FileTokenSource reads the token from a file, such as one kept up to date by another
+// process. Refreshing reads the file again, and fails if the token hasn't changed.
+type FileTokenSource struct {
+	Path string
+
+	mu    sync.Mutex
+	token string
+}
+
+// NewFileTokenSource returns a FileTokenSource reading the file at path.
+func NewFileTokenSource(path string) *FileTokenSource {
+	return &FileTokenSource{Path: path}
+}
+
+// Token reads the token from the file.
+func (s *FileTokenSource) Token(ctx context.Context) (string, error) {
+	token, err := s.read()
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	s.token = token
+	s.mu.Unlock()
+
+	return token, nil
+}
+
+// Refresh reads the token from the file again.
+func (s *FileTokenSource) Refresh(ctx context.Context) (string, error) {
+	token, err := s.read()
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if token == s.token {
+		return "", ErrTokenNotRefreshable
+	}
+	s.token = token
+
+	return token, nil
+}
+
+func (s *FileTokenSource) read() (string, error) {
+	data, err := ioutil.ReadFile(s.Path)
+	if err != nil {
+		return "", err
+	}
+
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", errors.New("token file " + s.Path + " is empty")
+	}
+	return token, nil
+}
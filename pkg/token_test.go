@@ -0,0 +1,169 @@
+package gospeckle
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingTokenSource hands out "old" and refreshes it to "new", after release is
+// closed if it is set.
+type countingTokenSource struct {
+	refreshes int32
+	release   chan struct{}
+	err       error
+}
+
+func (s *countingTokenSource) Token(ctx context.Context) (string, error) {
+	return "old", nil
+}
+
+func (s *countingTokenSource) Refresh(ctx context.Context) (string, error) {
+	atomic.AddInt32(&s.refreshes, 1)
+	if s.release != nil {
+		select {
+		case <-s.release:
+		case <-time.After(5 * time.Second):
+			return "", errors.New("the requests never all got a 401")
+		}
+	}
+	if s.err != nil {
+		return "", s.err
+	}
+	return "new", nil
+}
+
+// tokenServer accepts the "new" token only, and counts the requests it answers with a
+// 401. unauthorized is called with that count.
+func tokenServer(t *testing.T, requests *int32, unauthorized func(n int32)) *httptest.Server {
+	var rejected int32
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) != "{\"name\":\"replayed\"}\n" {
+			t.Errorf("got body %q", body)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if r.Header.Get("Authorization") != "new" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"success": false, "message": "unauthorized"}`))
+			if unauthorized != nil {
+				unauthorized(atomic.AddInt32(&rejected, 1))
+			}
+			return
+		}
+		w.Write([]byte(`{"success": true, "resource": {"_id": "s1"}}`))
+	}))
+}
+
+func newTokenClient(t *testing.T, server *httptest.Server, ts TokenSource) *Client {
+	apiURL, _ := url.Parse(server.URL)
+	client := NewClient(nil, apiURL, nil, "v1", "")
+	err := client.SetTokenSource(context.Background(), ts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func doTokenRequest(client *Client) error {
+	ctx := context.Background()
+	req, err := client.NewRequest(ctx, http.MethodPost, "streams", map[string]string{"name": "replayed"})
+	if err != nil {
+		return err
+	}
+	_, _, err = client.Do(ctx, req, nil, false)
+	return err
+}
+
+func TestRefreshOn401(t *testing.T) {
+	var requests int32
+	server := tokenServer(t, &requests, nil)
+	defer server.Close()
+
+	ts := &countingTokenSource{}
+	client := newTokenClient(t, server, ts)
+
+	err := doTokenRequest(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ts.refreshes != 1 || requests != 2 {
+		t.Errorf("got %v refreshes and %v requests, want 1 and 2", ts.refreshes, requests)
+	}
+	if token := client.currentToken(); token != "new" {
+		t.Errorf("got token %q, want %q", token, "new")
+	}
+}
+
+func TestConcurrentRefreshOn401(t *testing.T) {
+	const n = 10
+
+	ts := &countingTokenSource{release: make(chan struct{})}
+
+	var requests int32
+	server := tokenServer(t, &requests, func(rejected int32) {
+		if rejected == n {
+			close(ts.release)
+		}
+	})
+	defer server.Close()
+
+	client := newTokenClient(t, server, ts)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- doTokenRequest(client)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if ts.refreshes != 1 || requests != 2*n {
+		t.Errorf("got %v refreshes and %v requests, want 1 and %v", ts.refreshes, requests, 2*n)
+	}
+}
+
+func TestFailedRefreshOn401(t *testing.T) {
+	var requests int32
+	server := tokenServer(t, &requests, nil)
+	defer server.Close()
+
+	ts := &countingTokenSource{err: ErrTokenNotRefreshable}
+	client := newTokenClient(t, server, ts)
+
+	err := doTokenRequest(client)
+	errResp, ok := err.(*ErrorResponse)
+	if !ok {
+		t.Fatalf("got error %v, want an ErrorResponse", err)
+	}
+	if errResp.Response.StatusCode != http.StatusUnauthorized {
+		t.Errorf("got status %v, want %v", errResp.Response.StatusCode, http.StatusUnauthorized)
+	}
+
+	if ts.refreshes != 1 || requests != 1 {
+		t.Errorf("got %v refreshes and %v requests, want 1 and 1", ts.refreshes, requests)
+	}
+	if token := client.currentToken(); token != "old" {
+		t.Errorf("got token %q, want %q", token, "old")
+	}
+}
@@ -0,0 +1,198 @@
+package gospeckle
+
+import (
+	"context"
+	"reflect"
+)
+
+// StreamChange describes how a stream changed after an update event. Objects are
+// matched by ApplicationID when they have one and by ID otherwise, and layers by GUID
+// or name.
+type StreamChange struct {
+	// Event is the event that caused the stream to be fetched again. It is nil when the
+	// stream was fetched after the session reconnected.
+	Event  Event
+	Stream Stream
+
+	AddedObjects    []Object
+	RemovedObjects  []Object
+	ModifiedObjects []Object
+
+	AddedLayers    []Layer
+	RemovedLayers  []Layer
+	ModifiedLayers []Layer
+
+	// Err is set if the stream could not be fetched after an update.
+	Err error
+}
+
+// Empty reports whether the change holds no object or layer changes.
+func (c StreamChange) Empty() bool {
+	return len(c.AddedObjects) == 0 && len(c.RemovedObjects) == 0 && len(c.ModifiedObjects) == 0 &&
+		len(c.AddedLayers) == 0 && len(c.RemovedLayers) == 0 && len(c.ModifiedLayers) == 0
+}
+
+// Watch listens to a stream's update events and emits how its objects and layers
+// changed each time. The stream is fetched again after every update-global event and
+// after the websocket reconnects, and compared locally against the previous snapshot;
+// only non-empty changes and errors are emitted. The channel is closed once ctx is done.
+// The websocket connects as a temporary client, which is deleted when watching stops.
+func (s *StreamService) Watch(ctx context.Context, streamID string) (<-chan StreamChange, error) {
+	previous, _, err := s.Get(ctx, streamID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Refreshes are coalesced: a burst of events while the stream is being fetched
+	// only triggers one more fetch.
+	type trigger struct {
+		event Event
+	}
+	refresh := make(chan trigger, 1)
+	queue := func(t trigger) {
+		select {
+		case refresh <- t:
+		default:
+		}
+	}
+
+	reconnected := false
+	session := s.client.NewSession("", streamID, &SessionOptions{
+		Lifecycle: &ClientLifecycle{
+			DocumentName: "gospeckle stream watcher",
+			DocumentType: "watcher",
+			Ephemeral:    true,
+		},
+		OnStateChange: func(state SessionState, err error) {
+			switch state {
+			case SessionDisconnected:
+				reconnected = true
+			case SessionConnected:
+				if reconnected {
+					queue(trigger{})
+				}
+			}
+		},
+	})
+
+	session.On(EventUpdateGlobal, func(ctx context.Context, e Event) {
+		queue(trigger{event: e})
+	})
+
+	err = session.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(chan StreamChange)
+
+	go func() {
+		defer close(changes)
+		defer session.Close()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case t := <-refresh:
+				current, _, err := s.Get(ctx, streamID)
+				if err != nil {
+					if ctx.Err() != nil {
+						return
+					}
+					select {
+					case changes <- StreamChange{Event: t.event, Stream: previous, Err: err}:
+					case <-ctx.Done():
+						return
+					}
+					continue
+				}
+
+				change := diffStreamSnapshots(previous, current)
+				change.Event = t.event
+				previous = current
+
+				if change.Empty() {
+					continue
+				}
+
+				select {
+				case changes <- change:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return changes, nil
+}
+
+// diffStreamSnapshots compares the objects and layers of two versions of a stream.
+func diffStreamSnapshots(before Stream, after Stream) StreamChange {
+	change := StreamChange{Stream: after}
+
+	beforeObjects := map[string]Object{}
+	for _, o := range before.Objects {
+		beforeObjects[objectKey(o)] = o
+	}
+
+	afterObjects := map[string]bool{}
+	for _, o := range after.Objects {
+		key := objectKey(o)
+		afterObjects[key] = true
+
+		old, ok := beforeObjects[key]
+		if !ok {
+			change.AddedObjects = append(change.AddedObjects, o)
+		} else if !reflect.DeepEqual(old, o) {
+			change.ModifiedObjects = append(change.ModifiedObjects, o)
+		}
+	}
+
+	for _, o := range before.Objects {
+		if !afterObjects[objectKey(o)] {
+			change.RemovedObjects = append(change.RemovedObjects, o)
+		}
+	}
+
+	beforeLayers := map[string]Layer{}
+	for _, l := range before.Layers {
+		beforeLayers[layerKey(l)] = l
+	}
+
+	afterLayers := map[string]bool{}
+	for _, l := range after.Layers {
+		key := layerKey(l)
+		afterLayers[key] = true
+
+		old, ok := beforeLayers[key]
+		if !ok {
+			change.AddedLayers = append(change.AddedLayers, l)
+		} else if !reflect.DeepEqual(old, l) {
+			change.ModifiedLayers = append(change.ModifiedLayers, l)
+		}
+	}
+
+	for _, l := range before.Layers {
+		if !afterLayers[layerKey(l)] {
+			change.RemovedLayers = append(change.RemovedLayers, l)
+		}
+	}
+
+	return change
+}
+
+func objectKey(o Object) string {
+	if o.ApplicationID != "" {
+		return "app:" + o.ApplicationID
+	}
+	return "id:" + o.ID
+}
+
+func layerKey(l Layer) string {
+	if l.GUID != "" {
+		return "guid:" + l.GUID
+	}
+	return "name:" + l.Name
+}